@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+const (
+	apiDefaultLimit = 100
+	apiMaxLimit     = 1000
+	// requests within this time are served from the same Slurm output
+	apiCacheTTL = 10 * time.Second
+)
+
+// apiRecord is an item of a JSON API response. The filters "user",
+// "partition" and "state" only apply to records that have such a field.
+type apiRecord interface {
+	key() string
+	matches(filter url.Values) bool
+}
+
+type apiResponse struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Items  []apiRecord `json:"items"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// matchFilter reports whether one of the values of a record matches the
+// filter with the given name, states are compared case insensitively
+func matchFilter(filter url.Values, name string, values ...string) bool {
+	wanted := filter.Get(name)
+	if wanted == "" {
+		return true
+	}
+	for _, value := range values {
+		if value == wanted || (name == "state" && strings.EqualFold(value, wanted)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiNumber returns nil for values that JSON can not represent, such as
+// the +Inf of an UNLIMITED time limit, or values that were not reported
+func apiNumber(value float64, ok bool) *float64 {
+	if !ok || math.IsInf(value, 0) || math.IsNaN(value) {
+		return nil
+	}
+	return &value
+}
+
+func apiString(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "None" || value == "N/A" || value == "(null)" {
+		return ""
+	}
+	return value
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Errorf("Error encoding API response: %v", err)
+	}
+}
+
+func queryInt(query url.Values, name string, fallback int) (int, bool) {
+	value := query.Get(name)
+	if value == "" {
+		return fallback, true
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		return 0, false
+	}
+	return parsed, true
+}
+
+// apiHandler serves the records returned by list, sorted by their key,
+// filtered by the query parameters and paginated with limit and offset
+func apiHandler(list func() []apiRecord) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSON(w, http.StatusMethodNotAllowed, apiError{"method not allowed"})
+			return
+		}
+		query := r.URL.Query()
+		limit, ok := queryInt(query, "limit", apiDefaultLimit)
+		if !ok || limit == 0 || limit > apiMaxLimit {
+			writeJSON(w, http.StatusBadRequest, apiError{"limit must be between 1 and " + strconv.Itoa(apiMaxLimit)})
+			return
+		}
+		offset, ok := queryInt(query, "offset", 0)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, apiError{"offset must be a non-negative integer"})
+			return
+		}
+
+		records := list()
+		matched := make([]apiRecord, 0, len(records))
+		for _, record := range records {
+			if record.matches(query) {
+				matched = append(matched, record)
+			}
+		}
+		sort.Slice(matched, func(i, j int) bool { return matched[i].key() < matched[j].key() })
+
+		response := apiResponse{Total: len(matched), Offset: offset, Limit: limit, Items: []apiRecord{}}
+		if offset < len(matched) {
+			end := offset + limit
+			if end > len(matched) {
+				end = len(matched)
+			}
+			response.Items = matched[offset:end]
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+// cachedRecords returns list with its records kept for ttl, so that a
+// burst of requests runs the Slurm commands once. The records are shared
+// by the requests and must not be modified.
+func cachedRecords(list func() []apiRecord, ttl time.Duration) func() []apiRecord {
+	var mutex sync.Mutex
+	var ts time.Time
+	var records []apiRecord
+	return func() []apiRecord {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if records == nil || time.Since(ts) > ttl {
+			records = list()
+			ts = time.Now()
+		}
+		return records
+	}
+}
+
+// RegisterAPI adds the read-only JSON API under /api/v1
+func RegisterAPI(mux *http.ServeMux) {
+	mux.Handle("/api/v1/jobs", apiHandler(cachedRecords(apiJobs, apiCacheTTL)))
+	mux.Handle("/api/v1/nodes", apiHandler(cachedRecords(apiNodes, apiCacheTTL)))
+	mux.Handle("/api/v1/partitions", apiHandler(cachedRecords(apiPartitions, apiCacheTTL)))
+	mux.Handle("/api/v1/priorities", apiHandler(cachedRecords(apiPriorities, apiCacheTTL)))
+	mux.Handle("/api/v1/associations", apiHandler(cachedRecords(apiAssociations, apiCacheTTL)))
+}
+
+// JobView is a queued job as returned by /api/v1/jobs
+type JobView struct {
+	JobID            string             `json:"job_id"`
+	ArrayJobID       string             `json:"array_job_id,omitempty"`
+	ArrayTaskID      string             `json:"array_task_id,omitempty"`
+	User             string             `json:"user"`
+	Group            string             `json:"group"`
+	Account          string             `json:"account"`
+	Partition        string             `json:"partition"`
+	QOS              string             `json:"qos"`
+	State            string             `json:"state"`
+	Reason           string             `json:"reason,omitempty"`
+	Nodes            string             `json:"nodes,omitempty"`
+	CPUs             float64            `json:"cpus"`
+	MemoryBytes      float64            `json:"memory_bytes"`
+	GPUs             float64            `json:"gpus"`
+	TRES             map[string]float64 `json:"tres,omitempty"`
+	Priority         float64            `json:"priority"`
+	Dependency       string             `json:"dependency,omitempty"`
+	SubmitTime       *float64           `json:"submit_time"`
+	StartTime        *float64           `json:"start_time"`
+	EndTime          *float64           `json:"end_time"`
+	TimeLimitSeconds *float64           `json:"time_limit_seconds"`
+	RunTimeSeconds   float64            `json:"run_time_seconds"`
+}
+
+func NewJobView(jobid string, job *JobsMetrics) *JobView {
+	view := &JobView{
+		JobID:            jobid,
+		User:             apiString(job.user),
+		Group:            apiString(job.group),
+		Account:          apiString(job.account),
+		Partition:        job.partition,
+		QOS:              apiString(job.qos),
+		State:            JobState(job.status),
+		Reason:           apiString(job.pending_reason),
+		Nodes:            apiString(job.nodes),
+		CPUs:             job.num_cpus,
+		MemoryBytes:      jobMemory(job),
+		GPUs:             jobGPUs(job),
+		TRES:             job.tres,
+		Priority:         job.priority_value,
+		Dependency:       apiString(job.dependency),
+		SubmitTime:       apiNumber(job.submit_ts, job.has_submit),
+		StartTime:        apiNumber(job.start_ts, job.has_start),
+		EndTime:          apiNumber(job.end_ts, job.has_end),
+		TimeLimitSeconds: apiNumber(job.time_limit_sec, job.has_time_limit),
+		RunTimeSeconds:   job.run_time_sec,
+	}
+	if job.is_array_task {
+		view.ArrayJobID = job.array_job_id
+		view.ArrayTaskID = job.array_task_id
+	}
+	return view
+}
+
+func (v *JobView) key() string {
+	return v.JobID
+}
+
+func (v *JobView) matches(filter url.Values) bool {
+	return matchFilter(filter, "user", v.User) &&
+		matchFilter(filter, "partition", v.Partition) &&
+		matchFilter(filter, "state", v.State)
+}
+
+func apiJobs() []apiRecord {
+	jobs := JobGetMetrics()
+	records := make([]apiRecord, 0, len(jobs))
+	for jobid, job := range jobs {
+		records = append(records, NewJobView(jobid, job))
+	}
+	return records
+}
+
+// NodeView is a node as returned by /api/v1/nodes
+type NodeView struct {
+	Name             string   `json:"name"`
+	State            string   `json:"state"`
+	Partitions       []string `json:"partitions"`
+	Reason           string   `json:"reason,omitempty"`
+	IP               string   `json:"ip,omitempty"`
+	CPUsAllocated    float64  `json:"cpus_allocated"`
+	CPUsTotal        float64  `json:"cpus_total"`
+	CPULoad          *float64 `json:"cpu_load"`
+	MemoryBytes      *float64 `json:"memory_bytes"`
+	AllocMemoryBytes *float64 `json:"alloc_memory_bytes"`
+	FreeMemoryBytes  *float64 `json:"free_memory_bytes"`
+	LastBusyTime     *float64 `json:"last_busy_time"`
+	BootTime         *float64 `json:"boot_time"`
+	SlurmdStartTime  *float64 `json:"slurmd_start_time"`
+}
+
+func NewNodeView(name string, node *NodeResMetrics) *NodeView {
+	view := &NodeView{
+		Name:            name,
+		State:           node.state,
+		Partitions:      []string{},
+		IP:              node.ip,
+		LastBusyTime:    apiNumber(node.last_busy_ts, node.has_last_busy),
+		BootTime:        apiNumber(node.boot_ts, node.has_boot),
+		SlurmdStartTime: apiNumber(node.slurmd_start_ts, node.has_slurmd_start),
+	}
+	if node.reason != "OK" {
+		view.Reason = node.reason
+	}
+	if partitions := apiString(node.partitions); partitions != "" {
+		view.Partitions = strings.Split(partitions, ",")
+	}
+	view.CPUsAllocated, _ = strconv.ParseFloat(node.cpu_alloc, 64)
+	view.CPUsTotal, _ = strconv.ParseFloat(node.cpu_total, 64)
+	cpu_load, err := strconv.ParseFloat(node.cpu_load, 64)
+	view.CPULoad = apiNumber(cpu_load, err == nil)
+	view.MemoryBytes = apiNumber(ParseSlurmMemory(node.real_mem))
+	view.AllocMemoryBytes = apiNumber(ParseSlurmMemory(node.alloc_mem))
+	view.FreeMemoryBytes = apiNumber(ParseSlurmMemory(node.free_mem))
+	return view
+}
+
+func (v *NodeView) key() string {
+	return v.Name
+}
+
+// a node matches a state filter with its full state, e.g. "IDLE+DRAIN",
+// or with any of its flags
+func (v *NodeView) matches(filter url.Values) bool {
+	states := append([]string{v.State}, strings.Split(v.State, "+")...)
+	return matchFilter(filter, "partition", v.Partitions...) &&
+		matchFilter(filter, "state", states...)
+}
+
+func apiNodes() []apiRecord {
+	nodes := NodeResGetMetrics()
+	records := make([]apiRecord, 0, len(nodes))
+	for name, node := range nodes {
+		records = append(records, NewNodeView(name, node))
+	}
+	return records
+}
+
+// PartitionView is a partition as returned by /api/v1/partitions
+type PartitionView struct {
+	Name              string  `json:"name"`
+	Available         string  `json:"available"`
+	Nodes             float64 `json:"nodes"`
+	NodeList          string  `json:"node_list"`
+	NodeStates        string  `json:"node_states"`
+	Groups            string  `json:"groups"`
+	GRES              string  `json:"gres,omitempty"`
+	Reason            string  `json:"reason,omitempty"`
+	PriorityJobFactor float64 `json:"priority_job_factor"`
+	PriorityTier      float64 `json:"priority_tier"`
+}
+
+func NewPartitionView(name string, partition *NewPartitionMetrics) *PartitionView {
+	view := &PartitionView{
+		Name:       name,
+		Available:  partition.available,
+		NodeList:   partition.nodelist,
+		NodeStates: partition.node_states,
+		Groups:     partition.groups,
+		GRES:       apiString(partition.gres),
+		Reason:     apiString(partition.reason),
+	}
+	view.Nodes, _ = strconv.ParseFloat(partition.node_count, 64)
+	view.PriorityJobFactor, _ = strconv.ParseFloat(partition.priority_job_factor, 64)
+	view.PriorityTier, _ = strconv.ParseFloat(partition.priority_tier, 64)
+	return view
+}
+
+func (v *PartitionView) key() string {
+	return v.Name
+}
+
+func (v *PartitionView) matches(filter url.Values) bool {
+	return matchFilter(filter, "partition", v.Name) &&
+		matchFilter(filter, "state", v.Available)
+}
+
+func apiPartitions() []apiRecord {
+	partitions := ParsePartitionsMetrics()
+	records := make([]apiRecord, 0, len(partitions))
+	for name, partition := range partitions {
+		records = append(records, NewPartitionView(name, partition))
+	}
+	return records
+}
+
+// PriorityView is the priority of a pending job as returned by
+// /api/v1/priorities
+type PriorityView struct {
+	JobID           string             `json:"job_id"`
+	User            string             `json:"user"`
+	Account         string             `json:"account"`
+	Partition       string             `json:"partition"`
+	QOS             string             `json:"qos"`
+	Priority        float64            `json:"priority"`
+	AgeFactor       float64            `json:"age_factor"`
+	AssocFactor     float64            `json:"assoc_factor"`
+	JobSizeFactor   float64            `json:"jobsize_factor"`
+	NiceFactor      float64            `json:"nice_factor"`
+	PartitionFactor float64            `json:"partition_factor"`
+	QOSFactor       float64            `json:"qos_factor"`
+	FairshareFactor float64            `json:"fairshare_factor"`
+	SiteFactor      float64            `json:"site_factor"`
+	TRESFactors     map[string]float64 `json:"tres_factors,omitempty"`
+}
+
+func NewPriorityView(jobid string, prio *PrioMetrics, factors *JobPrioMetrics) *PriorityView {
+	// a job that sprio does not list has no factors
+	if factors == nil {
+		factors = &JobPrioMetrics{}
+	}
+	view := &PriorityView{
+		JobID:           jobid,
+		User:            apiString(prio.user),
+		Account:         apiString(prio.account),
+		Partition:       apiString(prio.partition),
+		QOS:             apiString(prio.qos_name),
+		AgeFactor:       factors.age_factor,
+		AssocFactor:     factors.assoc_factor,
+		JobSizeFactor:   factors.jobsize_factor,
+		NiceFactor:      factors.nice_factor,
+		PartitionFactor: factors.partition_factor,
+		QOSFactor:       factors.qos_factor,
+		FairshareFactor: factors.fairshare_factor,
+		SiteFactor:      factors.site_factor,
+		TRESFactors:     factors.tres_factors,
+	}
+	view.Priority, _ = strconv.ParseFloat(strings.TrimSpace(prio.priority), 64)
+	return view
+}
+
+func (v *PriorityView) key() string {
+	return v.JobID
+}
+
+// sprio only reports pending jobs
+func (v *PriorityView) matches(filter url.Values) bool {
+	return matchFilter(filter, "user", v.User) &&
+		matchFilter(filter, "partition", v.Partition) &&
+		matchFilter(filter, "state", "PENDING")
+}
+
+func apiPriorities() []apiRecord {
+	priorities, _, factors := PrioGetMetrics()
+	records := make([]apiRecord, 0, len(priorities))
+	for jobid, prio := range priorities {
+		records = append(records, NewPriorityView(jobid, prio, factors[jobid]))
+	}
+	return records
+}
+
+// AssociationView is an association as returned by /api/v1/associations.
+// Limits that are not set are left out, memory limits are in bytes.
+type AssociationView struct {
+	Cluster        string             `json:"cluster"`
+	Account        string             `json:"account"`
+	User           string             `json:"user,omitempty"`
+	Partition      string             `json:"partition,omitempty"`
+	Share          string             `json:"share,omitempty"`
+	Priority       string             `json:"priority,omitempty"`
+	QOS            []string           `json:"qos"`
+	DefaultQOS     string             `json:"default_qos,omitempty"`
+	GrpJobs        *float64           `json:"grp_jobs,omitempty"`
+	GrpSubmit      *float64           `json:"grp_submit,omitempty"`
+	GrpWall        string             `json:"grp_wall,omitempty"`
+	GrpTRES        map[string]float64 `json:"grp_tres,omitempty"`
+	GrpTRESMins    map[string]float64 `json:"grp_tres_minutes,omitempty"`
+	MaxJobs        *float64           `json:"max_jobs,omitempty"`
+	MaxSubmit      *float64           `json:"max_submit,omitempty"`
+	MaxWall        string             `json:"max_wall,omitempty"`
+	MaxTRES        map[string]float64 `json:"max_tres,omitempty"`
+	MaxTRESPerNode map[string]float64 `json:"max_tres_per_node,omitempty"`
+}
+
+func NewAssociationView(assoc *AcctMetrics) *AssociationView {
+	view := &AssociationView{
+		Cluster:        assoc.cluster,
+		Account:        assoc.account,
+		User:           apiString(assoc.user),
+		Partition:      apiString(assoc.partition),
+		Share:          apiString(assoc.share),
+		Priority:       apiString(assoc.priority),
+		QOS:            []string{},
+		DefaultQOS:     apiString(assoc.defqos),
+		GrpWall:        apiString(assoc.grpwall),
+		GrpTRES:        ParseTRES(apiString(assoc.grptres)),
+		GrpTRESMins:    ParseTRESCounts(apiString(assoc.grptresmins)),
+		MaxWall:        apiString(assoc.maxwall),
+		MaxTRES:        ParseTRES(apiString(assoc.maxtres)),
+		MaxTRESPerNode: ParseTRES(apiString(assoc.maxtrespernode)),
+	}
+	if qos := apiString(assoc.qos); qos != "" {
+		view.QOS = strings.Split(qos, ",")
+	}
+	view.GrpJobs = apiLimit(assoc.grpjobs)
+	view.GrpSubmit = apiLimit(assoc.grpsubmit)
+	view.MaxJobs = apiLimit(assoc.maxjobs)
+	view.MaxSubmit = apiLimit(assoc.maxsubmit)
+	return view
+}
+
+func apiLimit(value string) *float64 {
+	parsed, err := strconv.ParseFloat(apiString(value), 64)
+	return apiNumber(parsed, err == nil)
+}
+
+func (v *AssociationView) key() string {
+	return v.Cluster + "|" + v.Account + "|" + v.User + "|" + v.Partition
+}
+
+func (v *AssociationView) matches(filter url.Values) bool {
+	return matchFilter(filter, "user", v.User) &&
+		matchFilter(filter, "partition", v.Partition)
+}
+
+func apiAssociations() []apiRecord {
+	assocs, _ := ParseAcctMetrics()
+	records := make([]apiRecord, 0, len(assocs))
+	for _, assoc := range assocs {
+		records = append(records, NewAssociationView(assoc))
+	}
+	return records
+}
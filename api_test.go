@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func apiTestJobs() []apiRecord {
+	return []apiRecord{
+		&JobView{JobID: "3", User: "alice", Partition: "gpu", State: "RUNNING"},
+		&JobView{JobID: "1", User: "alice", Partition: "batch", State: "PENDING"},
+		&JobView{JobID: "2", User: "bob", Partition: "batch", State: "RUNNING"},
+		&JobView{JobID: "4", User: "alice", Partition: "batch", State: "RUNNING"},
+	}
+}
+
+type apiTestResponse struct {
+	Total  int       `json:"total"`
+	Offset int       `json:"offset"`
+	Limit  int       `json:"limit"`
+	Items  []JobView `json:"items"`
+}
+
+func apiGet(t *testing.T, handler http.Handler, target string) (int, apiTestResponse) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	var response apiTestResponse
+	if recorder.Code == http.StatusOK {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: invalid response: %v", target, err)
+		}
+	}
+	return recorder.Code, response
+}
+
+func jobIDs(response apiTestResponse) []string {
+	ids := []string{}
+	for _, item := range response.Items {
+		ids = append(ids, item.JobID)
+	}
+	return ids
+}
+
+func TestAPIFilters(t *testing.T) {
+	handler := apiHandler(apiTestJobs)
+	tests := []struct {
+		target string
+		ids    []string
+	}{
+		{"/api/v1/jobs", []string{"1", "2", "3", "4"}},
+		{"/api/v1/jobs?user=alice", []string{"1", "3", "4"}},
+		{"/api/v1/jobs?partition=batch&state=running", []string{"2", "4"}},
+		{"/api/v1/jobs?user=carol", []string{}},
+	}
+	for _, test := range tests {
+		code, response := apiGet(t, handler, test.target)
+		if code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", test.target, code)
+			continue
+		}
+		if ids := jobIDs(response); !reflect.DeepEqual(ids, test.ids) || response.Total != len(test.ids) {
+			t.Errorf("%s: items %v of %d, want %v", test.target, ids, response.Total, test.ids)
+		}
+	}
+}
+
+func TestAPIPagination(t *testing.T) {
+	handler := apiHandler(apiTestJobs)
+	tests := []struct {
+		target string
+		ids    []string
+	}{
+		{"/api/v1/jobs?limit=2", []string{"1", "2"}},
+		{"/api/v1/jobs?limit=2&offset=2", []string{"3", "4"}},
+		{"/api/v1/jobs?limit=2&offset=3", []string{"4"}},
+		{"/api/v1/jobs?offset=10", []string{}},
+	}
+	for _, test := range tests {
+		code, response := apiGet(t, handler, test.target)
+		if code != http.StatusOK {
+			t.Errorf("%s: status %d, want 200", test.target, code)
+			continue
+		}
+		if response.Total != 4 {
+			t.Errorf("%s: total %d, want 4", test.target, response.Total)
+		}
+		if ids := jobIDs(response); !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: items %v, want %v", test.target, ids, test.ids)
+		}
+	}
+}
+
+func TestAPILimitValidation(t *testing.T) {
+	handler := apiHandler(apiTestJobs)
+	for _, target := range []string{
+		"/api/v1/jobs?limit=0",
+		"/api/v1/jobs?limit=-1",
+		"/api/v1/jobs?limit=1001",
+		"/api/v1/jobs?limit=ten",
+		"/api/v1/jobs?offset=-5",
+	} {
+		if code, _ := apiGet(t, handler, target); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", target, code)
+		}
+	}
+	if code, response := apiGet(t, handler, "/api/v1/jobs?limit=1000"); code != http.StatusOK || response.Limit != 1000 {
+		t.Errorf("limit=1000: status %d, limit %d", code, response.Limit)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/jobs", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", recorder.Code)
+	}
+}
+
+func TestCachedRecords(t *testing.T) {
+	calls := 0
+	list := cachedRecords(func() []apiRecord {
+		calls++
+		return apiTestJobs()
+	}, time.Hour)
+	handler := apiHandler(list)
+	apiGet(t, handler, "/api/v1/jobs")
+	apiGet(t, handler, "/api/v1/jobs?user=alice")
+	if calls != 1 {
+		t.Errorf("listed the records %d times, want 1", calls)
+	}
+
+	expired := cachedRecords(func() []apiRecord {
+		calls++
+		return apiTestJobs()
+	}, 0)
+	expired()
+	time.Sleep(time.Millisecond)
+	expired()
+	if calls != 3 {
+		t.Errorf("listed the records %d times, want 3", calls)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ArrayTaskCount returns the number of tasks in a squeue array task
+// expression such as "5", "5-100", "[1,3,5-7]" or "5-100%10"
+func ArrayTaskCount(task_id string) float64 {
+	task_id = strings.Trim(strings.TrimSpace(task_id), "[]")
+	if idx := strings.Index(task_id, "%"); idx >= 0 {
+		task_id = task_id[:idx]
+	}
+	count := float64(0)
+	for _, item := range strings.Split(task_id, ",") {
+		// ranges may carry a step, e.g. "1-10:2"
+		step := 1.0
+		if idx := strings.Index(item, ":"); idx >= 0 {
+			step, _ = strconv.ParseFloat(item[idx+1:], 64)
+			item = item[:idx]
+			if step < 1 {
+				step = 1
+			}
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := strconv.ParseFloat(bounds[0], 64)
+		if err != nil {
+			continue
+		}
+		if len(bounds) == 1 {
+			count++
+			continue
+		}
+		last, err := strconv.ParseFloat(bounds[1], 64)
+		if err != nil || last < first {
+			continue
+		}
+		count += float64(int((last-first)/step)) + 1
+	}
+	return count
+}
+
+// arrayTaskState maps a job state to the pending, running, completed and
+// failed states of array tasks
+func arrayTaskState(state string) string {
+	switch JobState(state) {
+	case "PENDING", "REQUEUED", "REQUEUE_HOLD", "REQUEUE_FED", "SUSPENDED", "RESV_DEL_HOLD":
+		return "pending"
+	case "RUNNING", "COMPLETING", "CONFIGURING", "STAGE_OUT", "SIGNALING", "RESIZING":
+		return "running"
+	case "COMPLETED":
+		return "completed"
+	}
+	return "failed"
+}
+
+// AggregateArrays counts the tasks of every job array by state. Queued tasks
+// are taken from squeue, finished tasks from sacct.
+func AggregateArrays(jobs map[string]*JobsMetrics, completed map[string]*CompletedJobsMetrics) map[string]map[string]float64 {
+	arrays := make(map[string]map[string]float64)
+	add := func(array_job_id string, state string, count float64) {
+		if _, exists := arrays[array_job_id]; !exists {
+			arrays[array_job_id] = make(map[string]float64)
+		}
+		arrays[array_job_id][state] += count
+	}
+
+	for _, job := range jobs {
+		if !job.is_array_task {
+			continue
+		}
+		add(job.array_job_id, arrayTaskState(job.status), ArrayTaskCount(job.array_task_id))
+	}
+	for jobid, job := range completed {
+		idx := strings.Index(jobid, "_")
+		if idx < 0 || strings.Contains(jobid, ".") || !job.has_end {
+			continue
+		}
+		add(jobid[:idx], arrayTaskState(job.state), 1)
+	}
+	return arrays
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestArrayTaskCount(t *testing.T) {
+	tests := []struct {
+		input string
+		count float64
+	}{
+		{"5", 1},
+		{"[5-100]", 96},
+		{"[1-10:2]", 5},
+		{"[1-3,7,9-10]", 6},
+		{"[1-100%10]", 100},
+		{"[10-1]", 0},
+		{"N/A", 0},
+	}
+	for _, test := range tests {
+		if count := ArrayTaskCount(test.input); count != test.count {
+			t.Errorf("ArrayTaskCount(%q) = %v, want %v", test.input, count, test.count)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// jobs that left the queue without being reported by sacct are forgotten
+// after this long
+const chargebackJobRetention = 24 * time.Hour
+
+// chargebackRates holds the cost of one unit of a TRES for one hour by
+// partition and TRES name, the partition "*" applies to all partitions.
+// Memory and other sizes are charged per GiB.
+var chargebackRates map[string]map[string]float64
+
+// SetChargebackRates loads the rate table from a JSON file such as
+// {"*": {"cpu": 0.01}, "gpu": {"gres/gpu": 0.5}}. An empty path disables
+// the cost counter.
+func SetChargebackRates(path string) error {
+	if path == "" {
+		chargebackRates = nil
+		return nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	rates := make(map[string]map[string]float64)
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return err
+	}
+	chargebackRates = rates
+	return nil
+}
+
+func chargebackRate(partition string, tres string) float64 {
+	rate, ok := chargebackRates[partition][tres]
+	if !ok {
+		rate = chargebackRates["*"][tres]
+	}
+	if isTRESSize(tres) {
+		rate /= 1 << 30
+	}
+	return rate
+}
+
+type chargebackKey struct {
+	account string
+	user    string
+	tres    string
+}
+
+// chargebackJob records how many seconds of a job were already charged.
+// An ended job is kept while squeue still lists it, e.g. as COMPLETING, so
+// that it is not charged again.
+type chargebackJob struct {
+	Charged  float64 `json:"charged"`
+	LastSeen int64   `json:"last_seen"`
+	Ended    bool    `json:"ended,omitempty"`
+}
+
+type chargebackSeries struct {
+	Account string  `json:"account"`
+	User    string  `json:"user"`
+	TRES    string  `json:"tres,omitempty"`
+	Value   float64 `json:"value"`
+}
+
+type chargebackState struct {
+	Updated     int64                     `json:"updated"`
+	TRESSeconds []chargebackSeries        `json:"tres_seconds"`
+	Cost        []chargebackSeries        `json:"cost"`
+	Jobs        map[string]*chargebackJob `json:"jobs"`
+}
+
+// Chargeback accumulates the TRES-seconds consumed by each account and
+// user. Running jobs are charged for the run time since the previous
+// collection, finished jobs for the rest of their elapsed time as
+// reported by sacct. The counters are persisted to a state file.
+type Chargeback struct {
+	mutex        sync.Mutex
+	state_file   string
+	loaded       bool
+	restored     int64
+	tres_seconds map[chargebackKey]float64
+	cost         map[chargebackKey]float64
+	jobs         map[string]*chargebackJob
+
+	tres_seconds_desc *prometheus.Desc
+	cost_desc         *prometheus.Desc
+}
+
+func NewChargeback(state_file string) *Chargeback {
+	cb := &Chargeback{
+		state_file:        state_file,
+		tres_seconds:      make(map[chargebackKey]float64),
+		cost:              make(map[chargebackKey]float64),
+		jobs:              make(map[string]*chargebackJob),
+		tres_seconds_desc: prometheus.NewDesc("slurm_account_tres_seconds_total", "TRES-seconds consumed by jobs, memory and other sizes in byte-seconds", []string{"account", "user", "tres"}, nil),
+		cost_desc:         prometheus.NewDesc("slurm_account_cost_total", "Cost of the TRES consumed by jobs according to the chargeback rates", []string{"account", "user"}, nil),
+	}
+	cb.loadState()
+	return cb
+}
+
+func (cb *Chargeback) loadState() {
+	if cb.state_file == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(cb.state_file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading chargeback state file %s: %v", cb.state_file, err)
+		}
+		return
+	}
+	var state chargebackState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Error parsing chargeback state file %s: %v", cb.state_file, err)
+		return
+	}
+	for _, series := range state.TRESSeconds {
+		cb.tres_seconds[chargebackKey{series.Account, series.User, series.TRES}] = series.Value
+	}
+	for _, series := range state.Cost {
+		cb.cost[chargebackKey{series.Account, series.User, ""}] = series.Value
+	}
+	if state.Jobs != nil {
+		cb.jobs = state.Jobs
+	}
+	cb.restored = state.Updated
+	cb.loaded = true
+}
+
+func (cb *Chargeback) saveState() {
+	if cb.state_file == "" {
+		return
+	}
+	state := chargebackState{Updated: time.Now().Unix(), Jobs: cb.jobs}
+	for key, value := range cb.tres_seconds {
+		state.TRESSeconds = append(state.TRESSeconds, chargebackSeries{key.account, key.user, key.tres, value})
+	}
+	for key, value := range cb.cost {
+		state.Cost = append(state.Cost, chargebackSeries{key.account, key.user, "", value})
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		log.Printf("Error encoding chargeback state: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cb.state_file), 0755); err != nil {
+		log.Printf("Error creating directory for chargeback state file %s: %v", cb.state_file, err)
+		return
+	}
+	// write to a temporary file first so a crash never leaves a truncated state
+	tmp := cb.state_file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Error writing chargeback state file %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, cb.state_file); err != nil {
+		log.Printf("Error renaming chargeback state file %s: %v", tmp, err)
+	}
+}
+
+func (cb *Chargeback) charge(account string, user string, partition string, tres map[string]float64, seconds float64) {
+	for name, value := range tres {
+		cb.tres_seconds[chargebackKey{account, user, name}] += value * seconds
+		if rate := chargebackRate(partition, name); rate > 0 {
+			cb.cost[chargebackKey{account, user, ""}] += value * seconds / 3600 * rate
+		}
+	}
+}
+
+// Update charges the run time of the queued jobs since the previous
+// collection and the remaining elapsed time of the jobs sacct reported as
+// ended. Without a saved state the first collection only records the
+// run time of the running jobs.
+func (cb *Chargeback) Update(jobs map[string]*JobsMetrics, ended map[string]*CompletedJobsMetrics) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := time.Now().Unix()
+	for jobid, job := range jobs {
+		if job.run_time_sec <= 0 {
+			continue
+		}
+		entry, seen := cb.jobs[jobid]
+		if !seen {
+			entry = &chargebackJob{}
+			if !cb.loaded {
+				entry.Charged = job.run_time_sec
+			}
+			cb.jobs[jobid] = entry
+		}
+		entry.LastSeen = now
+		if entry.Ended {
+			continue
+		}
+		if delta := job.run_time_sec - entry.Charged; delta > 0 {
+			cb.charge(strings.TrimSpace(job.account), strings.TrimSpace(job.user), job.partition, job.tres, delta)
+			entry.Charged = job.run_time_sec
+		}
+	}
+
+	for jobid, job := range ended {
+		if strings.Contains(jobid, ".") {
+			continue
+		}
+		// a heterogeneous job is charged per component, as queued in squeue
+		parts := map[string]*JobStep{jobid: {elapsed_sec: job.elapsed_sec, alloc_tres: job.alloc_tres}}
+		if len(job.het_components) > 0 {
+			parts = make(map[string]*JobStep)
+			for _, step := range job.steps {
+				if step.step == "" {
+					parts[jobid+"+"+step.component] = step
+				}
+			}
+		}
+		for id, part := range parts {
+			entry, seen := cb.jobs[id]
+			if seen && entry.Ended {
+				continue
+			}
+			if _, queued := jobs[id]; queued {
+				cb.jobs[id] = &chargebackJob{Charged: part.elapsed_sec, LastSeen: now, Ended: true}
+			} else {
+				delete(cb.jobs, id)
+			}
+			// the first sacct query may return jobs that ended before the
+			// state was saved, they were charged already or never will be
+			if !seen && (!cb.loaded || job.end_ts <= float64(cb.restored)) {
+				continue
+			}
+			charged := 0.0
+			if seen {
+				charged = entry.Charged
+			}
+			if delta := part.elapsed_sec - charged; delta > 0 {
+				cb.charge(job.account, job.user, job.partition, ParseTRES(part.alloc_tres), delta)
+			}
+		}
+	}
+
+	for jobid, entry := range cb.jobs {
+		if now-entry.LastSeen > int64(chargebackJobRetention.Seconds()) {
+			delete(cb.jobs, jobid)
+		}
+	}
+	cb.loaded = true
+	cb.restored = 0
+	cb.saveState()
+}
+
+func (cb *Chargeback) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cb.tres_seconds_desc
+	ch <- cb.cost_desc
+}
+
+func (cb *Chargeback) Collect(ch chan<- prometheus.Metric) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	for key, value := range cb.tres_seconds {
+		ch <- prometheus.MustNewConstMetric(cb.tres_seconds_desc, prometheus.CounterValue, value, key.account, key.user, key.tres)
+	}
+	if chargebackRates == nil {
+		return
+	}
+	for key, value := range cb.cost {
+		ch <- prometheus.MustNewConstMetric(cb.cost_desc, prometheus.CounterValue, value, key.account, key.user)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func chargebackQueued(run_time_sec float64, status string) *JobsMetrics {
+	return &JobsMetrics{
+		account:      "physics",
+		user:         "alice",
+		partition:    "batch",
+		status:       status,
+		run_time_sec: run_time_sec,
+		tres:         map[string]float64{"cpu": 2},
+	}
+}
+
+func chargebackEnded(elapsed_sec float64, end time.Time) *CompletedJobsMetrics {
+	return &CompletedJobsMetrics{
+		account:     "physics",
+		user:        "alice",
+		partition:   "batch",
+		alloc_tres:  "cpu=2",
+		elapsed_sec: elapsed_sec,
+		end_ts:      float64(end.Unix()),
+		has_end:     true,
+	}
+}
+
+func cpuSeconds(cb *Chargeback) float64 {
+	return cb.tres_seconds[chargebackKey{"physics", "alice", "cpu"}]
+}
+
+// A job sacct reports as ended while squeue still lists it as COMPLETING
+// is charged once
+func TestChargebackCompletingJob(t *testing.T) {
+	cb := NewChargeback("")
+	cb.Update(map[string]*JobsMetrics{"1": chargebackQueued(100, "RUNNING")}, nil)
+	// the first collection only records the run time
+	if got := cpuSeconds(cb); got != 0 {
+		t.Fatalf("first collection charged %v, want 0", got)
+	}
+	cb.Update(map[string]*JobsMetrics{"1": chargebackQueued(150, "RUNNING")}, nil)
+	cb.Update(map[string]*JobsMetrics{"1": chargebackQueued(160, "COMPLETING")}, map[string]*CompletedJobsMetrics{"1": chargebackEnded(160, time.Now())})
+	if got := cpuSeconds(cb); got != 2*60 {
+		t.Errorf("charged %v, want %v", got, 2*60)
+	}
+	cb.Update(map[string]*JobsMetrics{"1": chargebackQueued(160, "COMPLETING")}, nil)
+	cb.Update(map[string]*JobsMetrics{}, nil)
+	if got := cpuSeconds(cb); got != 2*60 {
+		t.Errorf("charged %v after the job left the queue, want %v", got, 2*60)
+	}
+}
+
+func TestChargebackState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chargeback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state_file := filepath.Join(dir, "chargeback.json")
+
+	cb := NewChargeback(state_file)
+	if cb.loaded {
+		t.Error("loaded without a state file")
+	}
+	cb.Update(map[string]*JobsMetrics{"1": chargebackQueued(100, "RUNNING")}, nil)
+	cb.Update(map[string]*JobsMetrics{"1": chargebackQueued(200, "RUNNING")}, nil)
+
+	restarted := NewChargeback(state_file)
+	if !restarted.loaded || restarted.restored == 0 {
+		t.Fatalf("loaded = %v, restored = %v, want the saved state", restarted.loaded, restarted.restored)
+	}
+	if got := cpuSeconds(restarted); got != 2*100 {
+		t.Errorf("restored %v CPU-seconds, want %v", got, 2*100)
+	}
+	// with a saved state the first collection charges the run time since
+	// it was saved, including jobs that started meanwhile, but not jobs
+	// sacct reports as ended before
+	before := time.Unix(restarted.restored, 0).Add(-time.Minute)
+	restarted.Update(map[string]*JobsMetrics{
+		"1": chargebackQueued(300, "RUNNING"),
+		"2": chargebackQueued(50, "RUNNING"),
+	}, map[string]*CompletedJobsMetrics{
+		"3": chargebackEnded(1000, before),
+		"4": chargebackEnded(10, time.Unix(restarted.restored, 0).Add(time.Minute)),
+	})
+	if got, want := cpuSeconds(restarted), float64(2*(100+100+50+10)); got != want {
+		t.Errorf("charged %v after the restart, want %v", got, want)
+	}
+	if !restarted.loaded || restarted.restored != 0 {
+		t.Errorf("loaded = %v, restored = %v after the first collection", restarted.loaded, restarted.restored)
+	}
+}
+
+func TestChargebackRate(t *testing.T) {
+	defer func() { chargebackRates = nil }()
+	chargebackRates = map[string]map[string]float64{
+		"*":   {"cpu": 0.01, "mem": 0.002},
+		"gpu": {"cpu": 0.02, "gres/gpu": 0.5},
+	}
+	tests := []struct {
+		partition string
+		tres      string
+		rate      float64
+	}{
+		{"gpu", "cpu", 0.02},
+		{"gpu", "gres/gpu", 0.5},
+		{"batch", "cpu", 0.01},
+		{"batch", "gres/gpu", 0},
+		// the partition has rates, but not for memory
+		{"gpu", "mem", 0.002 / (1 << 30)},
+		{"batch", "mem", 0.002 / (1 << 30)},
+	}
+	for _, test := range tests {
+		if rate := chargebackRate(test.partition, test.tres); rate != test.rate {
+			t.Errorf("chargebackRate(%s, %s) = %v, want %v", test.partition, test.tres, rate, test.rate)
+		}
+	}
+
+	// 2 CPUs and 4 GiB for an hour
+	cb := NewChargeback("")
+	cb.charge("physics", "alice", "batch", map[string]float64{"cpu": 2, "mem": 4 << 30}, 3600)
+	if got, want := cb.cost[chargebackKey{"physics", "alice", ""}], 2*0.01+4*0.002; got != want {
+		t.Errorf("cost = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type CompletedJobsMetrics struct {
+	user              string
+	account           string
+	state             string
+	partition         string
+	start             string
+	end               string
+	elapsed           string
+	nodes             string
+	qos               string
+	priority          string
+	alloc_tres        string
+	submit            string
+	eligible          string
+	total_cpu         string
+	max_rss           string
+	req_mem           string
+	exit_code         string
+	derived_exit_code string
+
+	start_ts     float64
+	end_ts       float64
+	submit_ts    float64
+	eligible_ts  float64
+	has_start    bool
+	has_end      bool
+	has_submit   bool
+	has_eligible bool
+
+	elapsed_sec    float64
+	total_cpu_sec  float64
+	cpu_time_sec   float64
+	max_rss_bytes  float64
+	req_mem_bytes  float64
+	restarts       float64
+	time_limit_sec float64
+	has_time_limit bool
+	cpu_efficiency float64
+	mem_efficiency float64
+	has_cpu_eff    bool
+	has_mem_eff    bool
+
+	steps          []*JobStep
+	het_components []string
+}
+
+// JobStep stores a step of a job, such as "batch", "extern" or "0", or
+// a component of a heterogeneous job
+type JobStep struct {
+	component     string
+	step          string
+	state         string
+	elapsed_sec   float64
+	exit_code     float64
+	signal        float64
+	max_rss_bytes float64
+	alloc_tres    string
+}
+
+func newJobStep(component string, step string, record *CompletedJobsMetrics) *JobStep {
+	job_step := &JobStep{
+		component:     component,
+		step:          step,
+		state:         JobState(record.state),
+		elapsed_sec:   record.elapsed_sec,
+		max_rss_bytes: record.max_rss_bytes,
+		alloc_tres:    record.alloc_tres,
+	}
+	job_step.exit_code, job_step.signal = ParseExitCode(record.exit_code)
+	return job_step
+}
+
+// SplitJobID splits a sacct job ID such as "123+1.batch" into the job
+// "123", the heterogeneous job component "1" and the step "batch"
+func SplitJobID(jobid string) (string, string, string) {
+	step := ""
+	if idx := strings.Index(jobid, "."); idx >= 0 {
+		step = jobid[idx+1:]
+		jobid = jobid[:idx]
+	}
+	component := ""
+	if idx := strings.Index(jobid, "+"); idx >= 0 {
+		component = jobid[idx+1:]
+		jobid = jobid[:idx]
+	}
+	return jobid, component, step
+}
+
+// ParseExitCode splits a sacct exit code "code:signal"
+func ParseExitCode(exit_code string) (float64, float64) {
+	parts := strings.SplitN(exit_code, ":", 2)
+	code, _ := strconv.ParseFloat(parts[0], 64)
+	signal := float64(0)
+	if len(parts) == 2 {
+		signal, _ = strconv.ParseFloat(parts[1], 64)
+	}
+	return code, signal
+}
+
+func parseCompletedJobLine(split []string) *CompletedJobsMetrics {
+	job := &CompletedJobsMetrics{}
+	job.user = split[1]
+	job.account = split[2]
+	job.partition = split[3]
+	job.state = split[4]
+	job.start = split[5]
+	job.end = split[6]
+	job.elapsed = split[7]
+	job.nodes = split[8]
+	job.priority = split[9]
+	job.qos = split[10]
+	job.alloc_tres = split[11]
+	job.submit = split[12]
+	job.eligible = split[13]
+	job.total_cpu = split[14]
+	job.max_rss = split[16]
+	job.req_mem = split[17]
+	job.exit_code = split[18]
+	job.derived_exit_code = split[19]
+	job.restarts, _ = strconv.ParseFloat(split[20], 64)
+	job.time_limit_sec, job.has_time_limit = ParseSlurmDuration(split[21])
+	job.start_ts, job.has_start = ParseSlurmTime(split[5])
+	job.end_ts, job.has_end = ParseSlurmTime(split[6])
+	job.submit_ts, job.has_submit = ParseSlurmTime(split[12])
+	job.eligible_ts, job.has_eligible = ParseSlurmTime(split[13])
+	job.elapsed_sec, _ = ParseSlurmDuration(split[7])
+	job.total_cpu_sec, _ = ParseSlurmDuration(split[14])
+	job.cpu_time_sec, _ = strconv.ParseFloat(split[15], 64)
+	job.max_rss_bytes, _ = ParseSlurmMemory(split[16])
+	job.req_mem_bytes = requestedMemory(split[17], split[11])
+	return job
+}
+
+// ParseCompletedJobMetrics takes the output of sacct
+// It returns a map of metrics per job, with the steps and the
+// heterogeneous job components attached to their job
+func ParseCompletedJobMetrics(input []byte) map[string]*CompletedJobsMetrics {
+	completed_jobs := make(map[string]*CompletedJobsMetrics, 15)
+	components := make(map[string]map[string]*CompletedJobsMetrics)
+	steps := make(map[string][]*JobStep)
+
+	lines := strings.Split(string(input), "\n")
+	for _, line := range lines {
+		if strings.Contains(line, "|") {
+			split := strings.Split(line, "|")
+			for i, val := range split {
+				if val == "" {
+					split[i] = "None"
+				}
+			}
+			jobid, component, step := SplitJobID(strings.Fields(split[0])[0])
+			record := parseCompletedJobLine(split)
+			switch {
+			case step != "":
+				steps[jobid] = append(steps[jobid], newJobStep(component, step, record))
+			case component != "":
+				if _, exists := components[jobid]; !exists {
+					components[jobid] = make(map[string]*CompletedJobsMetrics)
+				}
+				components[jobid][component] = record
+			default:
+				completed_jobs[jobid] = record
+			}
+		}
+	}
+
+	// a heterogeneous job is reported like its first component, it ends
+	// when all of its components ended
+	for jobid, parts := range components {
+		names := make([]string, 0, len(parts))
+		for name := range parts {
+			names = append(names, name)
+		}
+		// components are numbered, "10" comes after "2"
+		sort.Slice(names, func(i, j int) bool {
+			a, _ := strconv.Atoi(names[i])
+			b, _ := strconv.Atoi(names[j])
+			return a < b
+		})
+		job := *parts[names[0]]
+		job.het_components = names
+		job.total_cpu_sec, job.cpu_time_sec, job.req_mem_bytes = 0, 0, 0
+		for _, name := range names {
+			part := parts[name]
+			job.total_cpu_sec += part.total_cpu_sec
+			job.cpu_time_sec += part.cpu_time_sec
+			job.req_mem_bytes += part.req_mem_bytes
+			if part.max_rss_bytes > job.max_rss_bytes {
+				job.max_rss_bytes = part.max_rss_bytes
+			}
+			if !part.has_end {
+				job.has_end = false
+			} else if job.has_end && part.end_ts > job.end_ts {
+				job.end_ts = part.end_ts
+				job.end = part.end
+			}
+			job.steps = append(job.steps, newJobStep(name, "", part))
+		}
+		completed_jobs[jobid] = &job
+	}
+
+	// MaxRSS is only reported for job steps, the peak of all steps is
+	// the peak of the job
+	for jobid, job_steps := range steps {
+		job, exists := completed_jobs[jobid]
+		if !exists {
+			continue
+		}
+		for _, step := range job_steps {
+			if step.max_rss_bytes > job.max_rss_bytes {
+				job.max_rss_bytes = step.max_rss_bytes
+			}
+		}
+		job.steps = append(job.steps, job_steps...)
+	}
+
+	for _, job := range completed_jobs {
+		if job.cpu_time_sec > 0 && job.has_end {
+			job.cpu_efficiency = job.total_cpu_sec / job.cpu_time_sec
+			job.has_cpu_eff = true
+		}
+		if job.req_mem_bytes > 0 && job.has_end {
+			job.mem_efficiency = job.max_rss_bytes / job.req_mem_bytes
+			job.has_mem_eff = true
+		}
+	}
+
+	return completed_jobs
+}
+
+// requestedMemory returns the memory of a job in bytes. The allocated TRES
+// hold the total, ReqMem may be given per node ("n") or per CPU ("c").
+func requestedMemory(req_mem string, alloc_tres string) float64 {
+	tres := ParseTRES(alloc_tres)
+	if mem, ok := tres["mem"]; ok {
+		return mem
+	}
+	mem, ok := ParseSlurmMemory(req_mem)
+	if !ok {
+		return 0
+	}
+	if strings.HasSuffix(req_mem, "n") && tres["node"] > 0 {
+		return mem * tres["node"]
+	}
+	if strings.HasSuffix(req_mem, "c") && tres["cpu"] > 0 {
+		return mem * tres["cpu"]
+	}
+	return mem
+}
+
+// CompletedJobData executes sacct for all jobs active between since and now
+func CompletedJobData(since time.Time) []byte {
+	cmd := exec.Command("/bin/bash", "-c", fmt.Sprintf(SACCT_JOBS, FormatSlurmTime(since)))
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if len(exitErr.Stderr) == 0 && exitErr.ExitCode() == 1 {
+				return []byte{}
+			} else {
+				log.Printf("Error executing sacct command: %v, stderr: %s", err, exitErr.Stderr)
+			}
+		} else {
+			log.Printf("Error executing sacct command: %v", err)
+		}
+		return []byte("")
+	}
+	return out
+}
+
+// JobState returns the base state of a sacct state such as "CANCELLED by 0"
+func JobState(state string) string {
+	fields := strings.Fields(state)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// sacct is queried from this long before the watermark, slurmdbd may
+// write the record of a job after the records of jobs that ended later
+const sacctOverlap = 10 * time.Minute
+
+// CompletedJobsCache keeps the jobs returned by sacct for the retention
+// window, so that every collection only queries jobs that ended after the
+// newest end time seen so far (the watermark).
+type CompletedJobsCache struct {
+	mutex      sync.Mutex
+	jobs       map[string]*CompletedJobsMetrics
+	loaded     bool
+	watermark  time.Time
+	state_file string
+	retention  time.Duration
+	// end time of the jobs counted within the overlap before the
+	// watermark, persisted with it to count them once across restarts
+	counted map[string]float64
+	query   func(since time.Time) []byte
+}
+
+func NewCompletedJobsCache(state_file string, retention time.Duration) *CompletedJobsCache {
+	cache := &CompletedJobsCache{
+		jobs:       make(map[string]*CompletedJobsMetrics),
+		state_file: state_file,
+		retention:  retention,
+		counted:    make(map[string]float64),
+		query:      CompletedJobData,
+	}
+	cache.loadWatermark()
+	return cache
+}
+
+// The state file holds the watermark on the first line, followed by the
+// job ID and end time of the jobs counted within the overlap
+func (c *CompletedJobsCache) loadWatermark() {
+	if c.state_file == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(c.state_file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading sacct state file %s: %v", c.state_file, err)
+		}
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	seconds, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		log.Printf("Error parsing sacct state file %s: %v", c.state_file, err)
+		return
+	}
+	c.watermark = time.Unix(seconds, 0)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if end_ts, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			c.counted[fields[0]] = end_ts
+		}
+	}
+}
+
+func (c *CompletedJobsCache) saveWatermark() {
+	if c.state_file == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(c.state_file), 0755); err != nil {
+		log.Printf("Error creating directory for sacct state file %s: %v", c.state_file, err)
+		return
+	}
+	jobids := make([]string, 0, len(c.counted))
+	for jobid := range c.counted {
+		jobids = append(jobids, jobid)
+	}
+	sort.Strings(jobids)
+	var state strings.Builder
+	state.WriteString(strconv.FormatInt(c.watermark.Unix(), 10) + "\n")
+	for _, jobid := range jobids {
+		state.WriteString(jobid + " " + strconv.FormatFloat(c.counted[jobid], 'f', -1, 64) + "\n")
+	}
+	// write to a temporary file first so a crash never leaves a truncated state
+	tmp := c.state_file + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(state.String()), 0644); err != nil {
+		log.Printf("Error writing sacct state file %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, c.state_file); err != nil {
+		log.Printf("Error renaming sacct state file %s: %v", tmp, err)
+	}
+}
+
+// Update queries sacct for jobs active since shortly before the watermark
+// and merges them into the cache. It returns a snapshot of the cached jobs
+// and the jobs that ended since the previous update.
+func (c *CompletedJobsCache) Update() (map[string]*CompletedJobsMetrics, map[string]*CompletedJobsMetrics) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	oldest := now.Add(-c.retention)
+
+	// the first query fills the whole retention window, jobs that ended
+	// before the overlap of a persisted watermark were already counted by
+	// a previous run, those within it are known by their ID
+	since := c.watermark.Add(-sacctOverlap)
+	counted := float64(0)
+	if !c.loaded {
+		since = oldest
+		if !c.watermark.IsZero() {
+			counted = float64(c.watermark.Add(-sacctOverlap).Unix())
+		}
+	} else if since.Before(oldest) {
+		since = oldest
+	}
+
+	parsed := ParseCompletedJobMetrics(c.query(since))
+	c.loaded = true
+	finished := make(map[string]*CompletedJobsMetrics)
+	newest := c.watermark
+	for jobid, job := range parsed {
+		previous, exists := c.jobs[jobid]
+		if _, seen := c.counted[jobid]; job.has_end && (!exists || !previous.has_end) && job.end_ts > counted && !seen {
+			finished[jobid] = job
+			c.counted[jobid] = job.end_ts
+		}
+		if job.has_end && time.Unix(int64(job.end_ts), 0).After(newest) {
+			newest = time.Unix(int64(job.end_ts), 0)
+		}
+		c.jobs[jobid] = job
+	}
+
+	for jobid, job := range c.jobs {
+		// unfinished jobs are returned by every query until they end
+		if !job.has_end {
+			if _, exists := parsed[jobid]; !exists {
+				delete(c.jobs, jobid)
+			}
+			continue
+		}
+		if job.end_ts < float64(oldest.Unix()) {
+			delete(c.jobs, jobid)
+		}
+	}
+
+	// jobs that ended before the overlap are not queried again
+	for jobid, end_ts := range c.counted {
+		if end_ts < float64(newest.Add(-sacctOverlap).Unix()) {
+			delete(c.counted, jobid)
+		}
+	}
+	if newest.After(c.watermark) || len(finished) > 0 {
+		c.watermark = newest
+		c.saveWatermark()
+	}
+
+	snapshot := make(map[string]*CompletedJobsMetrics, len(c.jobs))
+	for jobid, job := range c.jobs {
+		snapshot[jobid] = job
+	}
+	return snapshot, finished
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sacctLine returns a sacct line of a job that ended at end, a zero end
+// for a running job
+func sacctLine(jobid string, end time.Time) string {
+	end_field := "Unknown"
+	if !end.IsZero() {
+		end_field = FormatSlurmTime(end)
+	}
+	start := FormatSlurmTime(end.Add(-time.Hour))
+	return strings.Join([]string{jobid, "alice", "physics", "batch", "COMPLETED", start, end_field,
+		"01:00:00", "node1", "1000", "normal", "cpu=1,mem=1G,node=1", start, start,
+		"00:30:00", "3600", "", "1Gn", "0:0", "0:0", "0", "02:00:00"}, "|")
+}
+
+// fakeSacct returns a query function that answers with the lines of the
+// jobs active since the query time and records the queried times
+func fakeSacct(lines func() []string, queries *[]time.Time) func(time.Time) []byte {
+	return func(since time.Time) []byte {
+		*queries = append(*queries, since)
+		return []byte(strings.Join(lines(), "\n"))
+	}
+}
+
+func finishedIDs(finished map[string]*CompletedJobsMetrics) string {
+	ids := []string{}
+	for jobid := range finished {
+		ids = append(ids, jobid)
+	}
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestCompletedJobsCacheLateRecord(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	lines := []string{sacctLine("10", now.Add(-time.Minute))}
+	var queries []time.Time
+	cache := NewCompletedJobsCache("", time.Hour)
+	cache.query = fakeSacct(func() []string { return lines }, &queries)
+
+	if _, finished := cache.Update(); finishedIDs(finished) != "10" {
+		t.Fatalf("first update finished %q, want 10", finishedIDs(finished))
+	}
+	// slurmdbd writes the record of job 11 after the one of job 10 although
+	// job 11 ended first
+	lines = append(lines, sacctLine("11", now.Add(-2*time.Minute)))
+	if _, finished := cache.Update(); finishedIDs(finished) != "11" {
+		t.Errorf("late record finished %q, want 11", finishedIDs(finished))
+	}
+	if _, finished := cache.Update(); len(finished) != 0 {
+		t.Errorf("repeated update finished %q, want none", finishedIDs(finished))
+	}
+	want := now.Add(-time.Minute - sacctOverlap)
+	if got := queries[len(queries)-1]; !got.Equal(want) {
+		t.Errorf("query since %v, want %v", got, want)
+	}
+}
+
+func TestCompletedJobsCacheRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sacct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	state_file := filepath.Join(dir, "sacct.state")
+
+	now := time.Now().Truncate(time.Second)
+	lines := []string{
+		sacctLine("1", now.Add(-time.Hour)),
+		sacctLine("2", now.Add(-5*time.Minute)),
+		sacctLine("3", now.Add(-time.Minute)),
+	}
+	var queries []time.Time
+	cache := NewCompletedJobsCache(state_file, 24*time.Hour)
+	cache.query = fakeSacct(func() []string { return lines }, &queries)
+	if _, finished := cache.Update(); finishedIDs(finished) != "1,2,3" {
+		t.Fatalf("first run finished %q, want 1,2,3", finishedIDs(finished))
+	}
+
+	// after a restart the jobs counted by the previous run are not counted
+	// again, neither before nor within the overlap, a job that ended while
+	// the exporter was down is
+	lines = append(lines, sacctLine("4", now.Add(-2*time.Minute)), sacctLine("5", now))
+	restarted := NewCompletedJobsCache(state_file, 24*time.Hour)
+	restarted.query = fakeSacct(func() []string { return lines }, &queries)
+	if !restarted.watermark.Equal(now.Add(-time.Minute)) {
+		t.Errorf("restored watermark %v, want %v", restarted.watermark, now.Add(-time.Minute))
+	}
+	jobs, finished := restarted.Update()
+	if finishedIDs(finished) != "4,5" {
+		t.Errorf("restarted run finished %q, want 4,5", finishedIDs(finished))
+	}
+	if len(jobs) != 5 {
+		t.Errorf("restarted run cached %d jobs, want 5", len(jobs))
+	}
+	// the first query of a run fills the whole retention window
+	if since := queries[len(queries)-1]; since.After(now.Add(-23 * time.Hour)) {
+		t.Errorf("first query since %v, want the start of the retention window", since)
+	}
+}
+
+const sacctHetJob = `123+0|alice|physics|batch|COMPLETED|2024-01-31T10:00:00|2024-01-31T11:00:00|01:00:00|node1|1000|normal|cpu=4,mem=4G,node=1|2024-01-31T09:00:00|2024-01-31T09:00:00|02:00:00|14400||4G|0:0|0:0|0|02:00:00
+123+0.batch||||COMPLETED|2024-01-31T10:00:00|2024-01-31T11:00:00|01:00:00|node1|||cpu=4,mem=4G,node=1|2024-01-31T10:00:00|2024-01-31T10:00:00|02:00:00|14400|1G||0:0||0|
+123+1|alice|physics|gpu|COMPLETED|2024-01-31T10:00:00|2024-01-31T11:30:00|01:30:00|node2|1000|normal|cpu=2,mem=8G,node=1|2024-01-31T09:00:00|2024-01-31T09:00:00|01:00:00|10800||8G|0:0|0:0|0|02:00:00
+123+1.batch||||COMPLETED|2024-01-31T10:00:00|2024-01-31T11:30:00|01:30:00|node2|||cpu=2,mem=8G,node=1|2024-01-31T10:00:00|2024-01-31T10:00:00|01:00:00|10800|3G||0:0||0|
+`
+
+func TestParseCompletedHetJob(t *testing.T) {
+	if err := SetSlurmTimezone("UTC"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetSlurmTimezone("")
+	const GiB = 1024 * 1024 * 1024
+	jobs := ParseCompletedJobMetrics([]byte(sacctHetJob))
+	if len(jobs) != 1 {
+		t.Fatalf("parsed %d jobs, want 1", len(jobs))
+	}
+	job := jobs["123"]
+	if job == nil {
+		t.Fatal("job 123 is missing")
+	}
+	if !reflect.DeepEqual(job.het_components, []string{"0", "1"}) {
+		t.Errorf("het_components = %v, want [0 1]", job.het_components)
+	}
+	if job.total_cpu_sec != 3*3600 || job.cpu_time_sec != 14400+10800 {
+		t.Errorf("CPU time = %v of %v, want %v of %v", job.total_cpu_sec, job.cpu_time_sec, 3*3600, 14400+10800)
+	}
+	if job.req_mem_bytes != 12*GiB {
+		t.Errorf("req_mem_bytes = %v, want %v", job.req_mem_bytes, 12*GiB)
+	}
+	// the peak of the job is the peak of the steps of all components
+	if job.max_rss_bytes != 3*GiB {
+		t.Errorf("max_rss_bytes = %v, want %v", job.max_rss_bytes, 3*GiB)
+	}
+	end := float64(time.Date(2024, 1, 31, 11, 30, 0, 0, time.UTC).Unix())
+	if !job.has_end || job.end_ts != end || job.end != "2024-01-31T11:30:00" {
+		t.Errorf("end = %v (%s), want %v", job.end_ts, job.end, end)
+	}
+	if job.partition != "batch" {
+		t.Errorf("partition = %s, want the one of the first component", job.partition)
+	}
+	// one entry per component and per step of a component
+	if len(job.steps) != 4 {
+		t.Errorf("parsed %d steps, want 4", len(job.steps))
+	}
+}
+
+const sacctJobSteps = `200|bob|chemistry|batch|FAILED|2024-01-31T10:00:00|2024-01-31T12:00:00|02:00:00|node[1-2]|500|normal|cpu=8,mem=16G,node=2|2024-01-31T09:00:00|2024-01-31T09:30:00|08:00:00|57600||8Gn|1:0|0:0|1|04:00:00
+200.batch||||FAILED|2024-01-31T10:00:00|2024-01-31T12:00:00|02:00:00|node1|||cpu=4,mem=8G,node=1|2024-01-31T10:00:00|2024-01-31T10:00:00|00:10:00|28800|512M||1:0||0|
+200.extern||||COMPLETED|2024-01-31T10:00:00|2024-01-31T12:00:00|02:00:00|node[1-2]|||cpu=8,mem=16G,node=2|2024-01-31T10:00:00|2024-01-31T10:00:00|00:00:00|57600|1M||0:0||0|
+200.0||||COMPLETED|2024-01-31T10:01:00|2024-01-31T11:01:00|01:00:00|node[1-2]|||cpu=8,mem=16G,node=2|2024-01-31T10:01:00|2024-01-31T10:01:00|05:00:00|28800|6G||0:0||0|
+200.1||||CANCELLED by 0|2024-01-31T11:01:00|2024-01-31T12:00:00|00:59:00|node[1-2]|||cpu=8,mem=16G,node=2|2024-01-31T11:01:00|2024-01-31T11:01:00|02:50:00|28320|4G||0:9||0|
+`
+
+func TestParseCompletedJobSteps(t *testing.T) {
+	const GiB = 1024 * 1024 * 1024
+	jobs := ParseCompletedJobMetrics([]byte(sacctJobSteps))
+	if len(jobs) != 1 {
+		t.Fatalf("parsed %d jobs, want 1", len(jobs))
+	}
+	job := jobs["200"]
+	if job == nil {
+		t.Fatal("job 200 is missing")
+	}
+	if job.max_rss_bytes != 6*GiB {
+		t.Errorf("max_rss_bytes = %v, want the peak of step 0 %v", job.max_rss_bytes, 6*GiB)
+	}
+	if job.req_mem_bytes != 16*GiB {
+		t.Errorf("req_mem_bytes = %v, want %v", job.req_mem_bytes, 16*GiB)
+	}
+	if !job.has_cpu_eff || job.cpu_efficiency != 8.0/16 {
+		t.Errorf("cpu_efficiency = %v, want %v", job.cpu_efficiency, 8.0/16)
+	}
+	if !job.has_mem_eff || job.mem_efficiency != 6.0/16 {
+		t.Errorf("mem_efficiency = %v, want %v", job.mem_efficiency, 6.0/16)
+	}
+	want := []JobStep{
+		{step: "batch", state: "FAILED", elapsed_sec: 7200, exit_code: 1, max_rss_bytes: 512 * 1024 * 1024},
+		{step: "extern", state: "COMPLETED", elapsed_sec: 7200, max_rss_bytes: 1024 * 1024},
+		{step: "0", state: "COMPLETED", elapsed_sec: 3600, max_rss_bytes: 6 * GiB},
+		{step: "1", state: "CANCELLED", elapsed_sec: 3540, signal: 9, max_rss_bytes: 4 * GiB},
+	}
+	if len(job.steps) != len(want) {
+		t.Fatalf("parsed %d steps, want %d", len(job.steps), len(want))
+	}
+	for i, step := range job.steps {
+		got := *step
+		got.alloc_tres = ""
+		if got != want[i] {
+			t.Errorf("step %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestSplitJobID(t *testing.T) {
+	tests := []struct {
+		jobid, job, component, step string
+	}{
+		{"123", "123", "", ""},
+		{"123.batch", "123", "", "batch"},
+		{"123.0", "123", "", "0"},
+		{"123+1", "123", "1", ""},
+		{"123+1.batch", "123", "1", "batch"},
+		{"123_4.extern", "123_4", "", "extern"},
+	}
+	for _, test := range tests {
+		job, component, step := SplitJobID(test.jobid)
+		if job != test.job || component != test.component || step != test.step {
+			t.Errorf("SplitJobID(%q) = %q, %q, %q, want %q, %q, %q", test.jobid, job, component, step, test.job, test.component, test.step)
+		}
+	}
+}
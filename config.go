@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// keys that report the state of slurmctld rather than its configuration,
+// they change without a change of the configuration
+var configVolatileKeys = map[string]bool{
+	"BOOT_TIME":   true,
+	"HASH_VAL":    true,
+	"NEXT_JOB_ID": true,
+}
+
+// SlurmConfig stores the key/value pairs of scontrol show config
+type SlurmConfig struct {
+	values    map[string]string
+	as_of     float64
+	has_as_of bool
+}
+
+func SlurmConfigGetMetrics() *SlurmConfig {
+	return ParseSlurmConfig(ExecuteCachedCommand(SCONTROL_SHOW_CONF, configCacheTTL))
+}
+
+// ParseSlurmConfig takes the output of scontrol show config. Keys of the
+// plugin sections that repeat a key seen before are ignored.
+func ParseSlurmConfig(input []byte) *SlurmConfig {
+	config := &SlurmConfig{values: make(map[string]string)}
+	for _, line := range strings.Split(string(input), "\n") {
+		if strings.HasPrefix(line, "Configuration data as of ") {
+			config.as_of, config.has_as_of = ParseSlurmTime(strings.TrimPrefix(line, "Configuration data as of "))
+			continue
+		}
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:idx])
+		if key == "" || strings.Contains(key, " ") {
+			continue
+		}
+		if _, exists := config.values[key]; !exists {
+			config.values[key] = strings.TrimSpace(line[idx+1:])
+		}
+	}
+	return config
+}
+
+// ParseConfigNumber returns the value of numeric settings such as "10000",
+// "1.00", "300 sec" or "7-00:00:00", durations in seconds
+func ParseConfigNumber(value string) (float64, bool) {
+	fields := strings.Fields(value)
+	if len(fields) == 2 && (fields[1] == "sec" || fields[1] == "secs") {
+		value = fields[0]
+	}
+	if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+		return parsed, true
+	}
+	if strings.Contains(value, ":") {
+		return ParseSlurmDuration(value)
+	}
+	return 0, false
+}
+
+// Hash returns a SHA-256 of the sorted key/value pairs
+func (sc *SlurmConfig) Hash() []byte {
+	keys := make([]string, 0, len(sc.values))
+	for key := range sc.values {
+		if !configVolatileKeys[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key + "=" + sc.values[key] + "\n"))
+	}
+	return hash.Sum(nil)
+}
+
+type ConfigCollector struct {
+	value       *prometheus.Desc
+	info        *prometheus.Desc
+	hash        *prometheus.Desc
+	last_change *prometheus.Desc
+
+	// the hash of the previous collection and when it changed
+	mutex      sync.Mutex
+	previous   string
+	changed_ts float64
+}
+
+func NewConfigCollector() *ConfigCollector {
+	return &ConfigCollector{
+		value:       prometheus.NewDesc("slurm_config_value", "Numeric setting of scontrol show config, durations in seconds", []string{"key"}, nil),
+		info:        prometheus.NewDesc("slurm_config_info", "Non-numeric setting of scontrol show config", []string{"key", "value"}, nil),
+		hash:        prometheus.NewDesc("slurm_config_hash", "First 48 bits of the SHA-256 of the running configuration", []string{"hash"}, nil),
+		last_change: prometheus.NewDesc("slurm_config_last_change_timestamp_seconds", "Time the running configuration last changed as Unix timestamp", nil, nil),
+	}
+}
+
+// Send all metric descriptions
+func (cc *ConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.value
+	ch <- cc.info
+	ch <- cc.hash
+	ch <- cc.last_change
+}
+
+func (cc *ConfigCollector) Collect(ch chan<- prometheus.Metric) {
+	config := SlurmConfigGetMetrics()
+	if len(config.values) == 0 {
+		return
+	}
+	for key, value := range config.values {
+		if number, ok := ParseConfigNumber(value); ok {
+			ch <- prometheus.MustNewConstMetric(cc.value, prometheus.GaugeValue, number, key)
+		} else {
+			ch <- prometheus.MustNewConstMetric(cc.info, prometheus.GaugeValue, 1, key, value)
+		}
+	}
+
+	sum := config.Hash()
+	hash := hex.EncodeToString(sum)
+	short := make([]byte, 8)
+	copy(short[2:], sum[:6])
+	ch <- prometheus.MustNewConstMetric(cc.hash, prometheus.GaugeValue, float64(binary.BigEndian.Uint64(short)), hash)
+
+	// slurmctld reports when it read the configuration, otherwise the
+	// change is noticed by the exporter
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+	if hash != cc.previous {
+		cc.changed_ts = float64(time.Now().Unix())
+		if config.has_as_of {
+			cc.changed_ts = config.as_of
+		}
+		cc.previous = hash
+	}
+	ch <- prometheus.MustNewConstMetric(cc.last_change, prometheus.GaugeValue, cc.changed_ts)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+const configOutput = `Configuration data as of 2024-01-31T12:00:00
+AccountingStorageType   = accounting_storage/slurmdbd
+BOOT_TIME               = 2024-01-01T08:00:00
+MaxJobCount             = 10000
+HASH_VAL                = Match
+MessageTimeout          = 10 sec
+NEXT_JOB_ID             = 4242
+PriorityDecayHalfLife   = 7-00:00:00
+PriorityWeightAge       = 1000
+SLURM_VERSION           = 23.02.5
+
+Cgroup Support Configuration:
+MaxJobCount             = 1
+AllowedRAMSpace         = 100.0%
+`
+
+func TestParseSlurmConfig(t *testing.T) {
+	if err := SetSlurmTimezone("UTC"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetSlurmTimezone("")
+	config := ParseSlurmConfig([]byte(configOutput))
+	as_of := float64(time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC).Unix())
+	if !config.has_as_of || config.as_of != as_of {
+		t.Errorf("as_of = %v, %v, want %v", config.as_of, config.has_as_of, as_of)
+	}
+	values := map[string]string{
+		"AccountingStorageType": "accounting_storage/slurmdbd",
+		"MaxJobCount":           "10000",
+		"SLURM_VERSION":         "23.02.5",
+		"AllowedRAMSpace":       "100.0%",
+	}
+	for key, value := range values {
+		if config.values[key] != value {
+			t.Errorf("%s = %q, want %q", key, config.values[key], value)
+		}
+	}
+	if _, ok := config.values["Cgroup Support Configuration:"]; ok {
+		t.Errorf("section title parsed as a key")
+	}
+
+	numbers := map[string]float64{
+		"MaxJobCount":           10000,
+		"MessageTimeout":        10,
+		"PriorityDecayHalfLife": 7 * 86400,
+	}
+	for key, number := range numbers {
+		if value, ok := ParseConfigNumber(config.values[key]); !ok || value != number {
+			t.Errorf("ParseConfigNumber(%s) = %v, %v, want %v", key, value, ok, number)
+		}
+	}
+	if _, ok := ParseConfigNumber(config.values["AccountingStorageType"]); ok {
+		t.Errorf("AccountingStorageType parsed as a number")
+	}
+
+	// the boot time changes without a change of the configuration
+	rebooted := ParseSlurmConfig(bytes.Replace([]byte(configOutput), []byte("2024-01-01T08:00:00"), []byte("2024-01-02T08:00:00"), 1))
+	if !bytes.Equal(config.Hash(), rebooted.Hash()) {
+		t.Errorf("hash changed with BOOT_TIME")
+	}
+	// so does the ID of the next job with every submission
+	submitted := ParseSlurmConfig(bytes.Replace([]byte(configOutput), []byte("= 4242"), []byte("= 4243"), 1))
+	if !bytes.Equal(config.Hash(), submitted.Hash()) {
+		t.Errorf("hash changed with NEXT_JOB_ID")
+	}
+	changed := ParseSlurmConfig(bytes.Replace([]byte(configOutput), []byte("= 1000\n"), []byte("= 2000\n"), 1))
+	if bytes.Equal(config.Hash(), changed.Hash()) {
+		t.Errorf("hash did not change with PriorityWeightAge")
+	}
+}
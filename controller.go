@@ -0,0 +1,150 @@
+package main
+
+import (
+	"log"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ControllerStatus stores the state of a slurmctld reported by scontrol ping
+type ControllerStatus struct {
+	role string
+	host string
+	up   bool
+}
+
+var pingRe = regexp.MustCompile(`Slurmctld\((\S+)\) at (\S+) is (\S+)`)
+
+// ParsePing takes the output of scontrol ping, either one line per
+// controller, "Slurmctld(primary) at ctl1 is UP", or the combined form of
+// older releases, "Slurmctld(primary/backup) at ctl1/ctl2 is UP/DOWN"
+func ParsePing(input []byte) []*ControllerStatus {
+	controllers := []*ControllerStatus{}
+	for _, line := range strings.Split(string(input), "\n") {
+		matches := pingRe.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		roles := strings.Split(matches[1], "/")
+		hosts := strings.Split(matches[2], "/")
+		states := strings.Split(matches[3], "/")
+		if len(hosts) != len(roles) || len(states) != len(roles) {
+			continue
+		}
+		for i := range roles {
+			controllers = append(controllers, &ControllerStatus{
+				role: roles[i],
+				host: hosts[i],
+				up:   strings.EqualFold(states[i], "UP"),
+			})
+		}
+	}
+	return controllers
+}
+
+// CurrentController returns the controller in charge: the first one in
+// the order of SlurmctldHost that responds, or nil if none does
+func CurrentController(controllers []*ControllerStatus) *ControllerStatus {
+	for _, controller := range controllers {
+		if controller.up {
+			return controller
+		}
+	}
+	return nil
+}
+
+// ParseVersion takes the output of scontrol version, e.g. "slurm 23.02.5"
+func ParseVersion(input []byte) string {
+	fields := strings.Fields(string(input))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// PingGetMetrics runs scontrol ping and measures its duration. scontrol
+// exits with an error when a controller is down, its output is still used.
+func PingGetMetrics() ([]*ControllerStatus, float64) {
+	start := time.Now()
+	out, err := exec.Command("/bin/bash", "-c", SCONTROL_PING).Output()
+	duration := time.Since(start).Seconds()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			log.Printf("Error executing %s command: %v", SCONTROL_PING, err)
+		}
+	}
+	return ParsePing(out), duration
+}
+
+type ControllerCollector struct {
+	up                 *prometheus.Desc
+	in_control         *prometheus.Desc
+	ping_duration      *prometheus.Desc
+	client_version     *prometheus.Desc
+	controller_version *prometheus.Desc
+	version_mismatch   *prometheus.Desc
+}
+
+func NewControllerCollector() *ControllerCollector {
+	controller_labels := []string{"role", "host"}
+	return &ControllerCollector{
+		up:                 prometheus.NewDesc("slurm_controller_up", "1 if the slurmctld responds to scontrol ping, 0 if not", controller_labels, nil),
+		in_control:         prometheus.NewDesc("slurm_controller_in_control", "1 for the first responding slurmctld, which is in control of the cluster", controller_labels, nil),
+		ping_duration:      prometheus.NewDesc("slurm_controller_ping_duration_seconds", "Time scontrol ping took to answer", nil, nil),
+		client_version:     prometheus.NewDesc("slurm_client_version_info", "Slurm version of the client commands used by the exporter", []string{"version"}, nil),
+		controller_version: prometheus.NewDesc("slurm_controller_version_info", "Slurm version of slurmctld from scontrol show config", []string{"version"}, nil),
+		version_mismatch:   prometheus.NewDesc("slurm_version_mismatch", "1 if the client commands and slurmctld run different Slurm versions", nil, nil),
+	}
+}
+
+// Send all metric descriptions
+func (cc *ControllerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cc.up
+	ch <- cc.in_control
+	ch <- cc.ping_duration
+	ch <- cc.client_version
+	ch <- cc.controller_version
+	ch <- cc.version_mismatch
+}
+
+func (cc *ControllerCollector) Collect(ch chan<- prometheus.Metric) {
+	controllers, duration := PingGetMetrics()
+	current := CurrentController(controllers)
+	for _, controller := range controllers {
+		up, in_control := 0.0, 0.0
+		if controller.up {
+			up = 1
+		}
+		if controller == current {
+			in_control = 1
+		}
+		ch <- prometheus.MustNewConstMetric(cc.up, prometheus.GaugeValue, up, controller.role, controller.host)
+		ch <- prometheus.MustNewConstMetric(cc.in_control, prometheus.GaugeValue, in_control, controller.role, controller.host)
+	}
+	ch <- prometheus.MustNewConstMetric(cc.ping_duration, prometheus.GaugeValue, duration)
+
+	client := ParseVersion(ExecuteCommand(SCONTROL_VERSION))
+	if client != "" {
+		ch <- prometheus.MustNewConstMetric(cc.client_version, prometheus.GaugeValue, 1, client)
+	}
+	// the configuration can only be read from a responding controller
+	if current == nil {
+		return
+	}
+	controller := SlurmConfigGetMetrics().values["SLURM_VERSION"]
+	if controller == "" {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(cc.controller_version, prometheus.GaugeValue, 1, controller)
+	if client != "" {
+		mismatch := 0.0
+		if client != controller {
+			mismatch = 1
+		}
+		ch <- prometheus.MustNewConstMetric(cc.version_mismatch, prometheus.GaugeValue, mismatch)
+	}
+}
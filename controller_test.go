@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParsePing(t *testing.T) {
+	tests := []struct {
+		input   string
+		hosts   []string
+		up      []bool
+		current string
+	}{
+		{"Slurmctld(primary) at ctl1 is UP\nSlurmctld(backup) at ctl2 is UP\n", []string{"ctl1", "ctl2"}, []bool{true, true}, "ctl1"},
+		{"Slurmctld(primary) at ctl1 is DOWN\nSlurmctld(backup) at ctl2 is UP\n", []string{"ctl1", "ctl2"}, []bool{false, true}, "ctl2"},
+		{"Slurmctld(primary/backup) at ctl1/ctl2 is UP/DOWN\n", []string{"ctl1", "ctl2"}, []bool{true, false}, "ctl1"},
+		{"Slurmctld(primary) at ctl1 is DOWN\n", []string{"ctl1"}, []bool{false}, ""},
+		{"", []string{}, []bool{}, ""},
+	}
+	for _, test := range tests {
+		controllers := ParsePing([]byte(test.input))
+		if len(controllers) != len(test.hosts) {
+			t.Errorf("ParsePing(%q) returned %d controllers, want %d", test.input, len(controllers), len(test.hosts))
+			continue
+		}
+		for i, controller := range controllers {
+			if controller.host != test.hosts[i] || controller.up != test.up[i] {
+				t.Errorf("ParsePing(%q)[%d] = %s up %t, want %s up %t", test.input, i, controller.host, controller.up, test.hosts[i], test.up[i])
+			}
+		}
+		current := ""
+		if controller := CurrentController(controllers); controller != nil {
+			current = controller.host
+		}
+		if current != test.current {
+			t.Errorf("CurrentController(%q) = %q, want %q", test.input, current, test.current)
+		}
+	}
+	if controllers := ParsePing([]byte("Slurmctld(primary) at ctl1 is UP/DOWN\n")); len(controllers) != 0 {
+		t.Errorf("mismatched combined form parsed as %d controllers", len(controllers))
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	if version := ParseVersion([]byte("slurm 23.02.5\n")); version != "23.02.5" {
+		t.Errorf("ParseVersion = %q, want 23.02.5", version)
+	}
+	if version := ParseVersion([]byte("")); version != "" {
+		t.Errorf("ParseVersion of empty output = %q", version)
+	}
+}
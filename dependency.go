@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strings"
+)
+
+// Dependency is a single condition of a job dependency, such as
+// "afterok:123(unfulfilled)"
+type Dependency struct {
+	kind   string
+	jobid  string
+	status string
+}
+
+// ParseDependency splits the dependency of a job as printed by squeue,
+// e.g. "afterok:123_*(unfulfilled),afterany:456+10(failed)" or
+// "singleton(unfulfilled)". "(null)" means the job has no dependency.
+func ParseDependency(input string) []Dependency {
+	input = strings.TrimSpace(input)
+	dependencies := []Dependency{}
+	if input == "" || input == "(null)" || input == "N/A" {
+		return dependencies
+	}
+	// "," requires all conditions, "?" any of them
+	for _, item := range strings.FieldsFunc(input, func(r rune) bool { return r == ',' || r == '?' }) {
+		status := ""
+		if idx := strings.Index(item, "("); idx >= 0 {
+			status = strings.TrimSuffix(item[idx+1:], ")")
+			item = item[:idx]
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) == 1 {
+			dependencies = append(dependencies, Dependency{kind: parts[0], status: status})
+			continue
+		}
+		for _, jobid := range parts[1:] {
+			// drop the time of "after:123+10" and the "_*" of whole arrays
+			if idx := strings.Index(jobid, "+"); idx >= 0 {
+				jobid = jobid[:idx]
+			}
+			jobid = strings.TrimSuffix(jobid, "_*")
+			dependencies = append(dependencies, Dependency{kind: parts[0], jobid: jobid, status: status})
+		}
+	}
+	return dependencies
+}
+
+// NeverSatisfied reports whether a pending job waits on a dependency that
+// can no longer be fulfilled
+func NeverSatisfied(job *JobsMetrics) bool {
+	if job.pending_reason == "DependencyNeverSatisfied" {
+		return true
+	}
+	for _, dependency := range job.dependencies {
+		if dependency.status == "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// DependencyDepths returns for every queued job the length of the longest
+// chain of queued jobs it waits on. A job depending only on jobs that left
+// the queue has a depth of 1.
+func DependencyDepths(jobs map[string]*JobsMetrics) map[string]int {
+	// dependencies on a whole array refer to all of its tasks
+	arrays := make(map[string][]string)
+	for jobid, job := range jobs {
+		if job.is_array_task {
+			arrays[job.array_job_id] = append(arrays[job.array_job_id], jobid)
+		}
+	}
+
+	depths := make(map[string]int)
+	visiting := make(map[string]bool)
+	var depth func(jobid string) int
+	depth = func(jobid string) int {
+		if d, done := depths[jobid]; done {
+			return d
+		}
+		if visiting[jobid] {
+			return 0
+		}
+		visiting[jobid] = true
+		result := 0
+		for _, dependency := range jobs[jobid].dependencies {
+			if result < 1 {
+				result = 1
+			}
+			targets := arrays[dependency.jobid]
+			if _, queued := jobs[dependency.jobid]; queued {
+				targets = append(targets, dependency.jobid)
+			}
+			for _, target := range targets {
+				if d := depth(target) + 1; d > result {
+					result = d
+				}
+			}
+		}
+		visiting[jobid] = false
+		depths[jobid] = result
+		return result
+	}
+
+	for jobid := range jobs {
+		depth(jobid)
+	}
+	return depths
+}
+
+// UserChainDepths returns the longest dependency chain a pending job of
+// each user waits on, users without pending dependent jobs are left out
+func UserChainDepths(jobs map[string]*JobsMetrics, pending map[string]*JobsMetrics) map[string]float64 {
+	user_depths := make(map[string]float64)
+	depths := DependencyDepths(jobs)
+	for jobid, job := range pending {
+		user := strings.TrimSpace(job.user)
+		if depth := float64(depths[jobid]); depth > user_depths[user] {
+			user_depths[user] = depth
+		}
+	}
+	return user_depths
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		input        string
+		dependencies []Dependency
+	}{
+		{"(null)", []Dependency{}},
+		{"", []Dependency{}},
+		{"singleton(unfulfilled)", []Dependency{{kind: "singleton", status: "unfulfilled"}}},
+		{
+			"afterok:123_*(unfulfilled),afterany:456+10(failed)",
+			[]Dependency{{"afterok", "123", "unfulfilled"}, {"afterany", "456", "failed"}},
+		},
+		{
+			"afterok:1:2?afternotok:3",
+			[]Dependency{{"afterok", "1", ""}, {"afterok", "2", ""}, {"afternotok", "3", ""}},
+		},
+	}
+	for _, test := range tests {
+		if dependencies := ParseDependency(test.input); !reflect.DeepEqual(dependencies, test.dependencies) {
+			t.Errorf("ParseDependency(%q) = %v, want %v", test.input, dependencies, test.dependencies)
+		}
+	}
+}
+
+func TestUserChainDepths(t *testing.T) {
+	jobs := map[string]*JobsMetrics{
+		"1": {user: "alice"},
+		"2": {user: "alice", dependencies: ParseDependency("afterok:1(unfulfilled)")},
+		"3": {user: "alice", dependencies: ParseDependency("afterok:2(unfulfilled)")},
+		"4": {user: "bob"},
+		"5": {user: "carol", dependencies: ParseDependency("afterok:99(unfulfilled)")},
+	}
+	pending := map[string]*JobsMetrics{"2": jobs["2"], "3": jobs["3"], "4": jobs["4"], "5": jobs["5"]}
+	// bob has no dependent job and no series
+	want := map[string]float64{"alice": 2, "carol": 1}
+	if depths := UserChainDepths(jobs, pending); !reflect.DeepEqual(depths, want) {
+		t.Errorf("UserChainDepths = %v, want %v", depths, want)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Jobs using less CPU time than this are too short to judge and are left
+// out of the list of the least efficient jobs
+const minEfficiencyCPUTime = 3600
+
+// EfficiencyMetrics computes seff-style CPU and memory efficiency of
+// completed jobs: histograms of every finished job and the least
+// efficient jobs still within the retention window.
+type EfficiencyMetrics struct {
+	cpu_efficiency *prometheus.HistogramVec
+	mem_efficiency *prometheus.HistogramVec
+	cpu_lowest     *prometheus.Desc
+	mem_lowest     *prometheus.Desc
+}
+
+func NewEfficiencyMetrics() *EfficiencyMetrics {
+	buckets := []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1}
+	job_labels := []string{"JOBID", "USER", "ACCOUNT", "PARTITION"}
+	return &EfficiencyMetrics{
+		cpu_efficiency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_job_cpu_efficiency",
+			Help:    "CPU efficiency of finished jobs, TotalCPU divided by CPUTimeRAW",
+			Buckets: buckets,
+		}, []string{"account", "partition"}),
+		mem_efficiency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_job_memory_efficiency",
+			Help:    "Memory efficiency of finished jobs, peak MaxRSS of all steps divided by the requested memory",
+			Buckets: buckets,
+		}, []string{"account", "partition"}),
+		cpu_lowest: prometheus.NewDesc("slurm_job_cpu_efficiency_lowest", "CPU efficiency of the least CPU efficient completed jobs", job_labels, nil),
+		mem_lowest: prometheus.NewDesc("slurm_job_memory_efficiency_lowest", "Memory efficiency of the least memory efficient completed jobs", job_labels, nil),
+	}
+}
+
+func (em *EfficiencyMetrics) Describe(ch chan<- *prometheus.Desc) {
+	em.cpu_efficiency.Describe(ch)
+	em.mem_efficiency.Describe(ch)
+	ch <- em.cpu_lowest
+	ch <- em.mem_lowest
+}
+
+// Observe adds the jobs that finished since the previous collection to
+// the efficiency histograms
+func (em *EfficiencyMetrics) Observe(finished map[string]*CompletedJobsMetrics) {
+	for jobid, job := range finished {
+		if strings.Contains(jobid, ".") {
+			continue
+		}
+		if job.has_cpu_eff {
+			em.cpu_efficiency.WithLabelValues(job.account, job.partition).Observe(job.cpu_efficiency)
+		}
+		if job.has_mem_eff {
+			em.mem_efficiency.WithLabelValues(job.account, job.partition).Observe(job.mem_efficiency)
+		}
+	}
+}
+
+// lowestEfficiency returns up to n finished jobs ordered from the least
+// efficient one by the given efficiency
+func lowestEfficiency(completed map[string]*CompletedJobsMetrics, n int, efficiency func(*CompletedJobsMetrics) (float64, bool)) []string {
+	jobids := []string{}
+	for jobid, job := range completed {
+		if _, ok := efficiency(job); ok && !strings.Contains(jobid, ".") && job.cpu_time_sec >= minEfficiencyCPUTime {
+			jobids = append(jobids, jobid)
+		}
+	}
+	sort.Slice(jobids, func(i, j int) bool {
+		a, _ := efficiency(completed[jobids[i]])
+		b, _ := efficiency(completed[jobids[j]])
+		if a == b {
+			return jobids[i] < jobids[j]
+		}
+		return a < b
+	})
+	if n < 0 {
+		n = 0
+	}
+	if len(jobids) > n {
+		jobids = jobids[:n]
+	}
+	return jobids
+}
+
+func (em *EfficiencyMetrics) Collect(ch chan<- prometheus.Metric, completed map[string]*CompletedJobsMetrics, n int) {
+	em.cpu_efficiency.Collect(ch)
+	em.mem_efficiency.Collect(ch)
+
+	cpu := func(job *CompletedJobsMetrics) (float64, bool) { return job.cpu_efficiency, job.has_cpu_eff }
+	for _, jobid := range lowestEfficiency(completed, n, cpu) {
+		job := completed[jobid]
+		ch <- prometheus.MustNewConstMetric(em.cpu_lowest, prometheus.GaugeValue, job.cpu_efficiency, jobid, job.user, job.account, job.partition)
+	}
+	mem := func(job *CompletedJobsMetrics) (float64, bool) { return job.mem_efficiency, job.has_mem_eff }
+	for _, jobid := range lowestEfficiency(completed, n, mem) {
+		job := completed[jobid]
+		ch <- prometheus.MustNewConstMetric(em.mem_lowest, prometheus.GaugeValue, job.mem_efficiency, jobid, job.user, job.account, job.partition)
+	}
+}
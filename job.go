@@ -1,10 +1,10 @@
 package main
 
 import (
-	"log"
-	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -12,64 +12,120 @@ import (
 
 // JobsMetrics stores metrics for each node
 type JobsMetrics struct {
-	sub_time      string
-	start_time    string
-	end_time      string
-	time_limit    string
-	status        string
-	user          string
-	group         string
-	priority      string
-	run_time      string
-	nodes         string
-	cpus          string
-	min_mem       string
-	partition     string
-	account       string
-	reason        string
-	min_tmp_disk  string
-	tres_per_node string
-	qos           string
-	tres_alloc    string
-}
-
-type CompletedJobsMetrics struct {
-	user       string
-	account    string
-	state      string
-	partition  string
-	start      string
-	end        string
-	elapsed    string
-	nodes      string
-	new_start  string
-	new_end    string
-	qos        string
-	priority   string
-	alloc_tres string
-}
-
-func ShiftTimeBack(inputTime string) string {
-	t, err := time.Parse("2006-01-02T15:04:05", inputTime)
-	if err != nil {
-		log.Printf("Error parsing time in ShiftTimeBack: %v", err)
-		return inputTime
-	}
-
-	// minus 3 hours
-	shiftedTime := t.Add(-3 * time.Hour)
-
-	// Format back to string
-	return shiftedTime.Format("2006-01-02T15:04:05")
-}
-
-func JobGetMetrics() (map[string]*JobsMetrics, map[string]*CompletedJobsMetrics) {
+	sub_time       string
+	start_time     string
+	end_time       string
+	time_limit     string
+	status         string
+	user           string
+	group          string
+	priority       string
+	run_time       string
+	nodes          string
+	cpus           string
+	min_mem        string
+	partition      string
+	account        string
+	reason         string
+	pending_reason string
+	min_tmp_disk   string
+	tres_per_node  string
+	qos            string
+	tres_alloc     string
+	array_job_id   string
+	array_task_id  string
+	is_array_task  bool
+	tres           map[string]float64
+	dependency     string
+	dependencies   []Dependency
+
+	time_limit_sec float64
+	run_time_sec   float64
+	time_left_sec  float64
+	num_cpus       float64
+	min_mem_bytes  float64
+	priority_value float64
+	submit_ts      float64
+	start_ts       float64
+	end_ts         float64
+	has_time_limit bool
+	has_time_left  bool
+	has_min_mem    bool
+	has_submit     bool
+	has_start      bool
+	has_end        bool
+}
+
+// QueueAggregate sums the resources requested by a group of queued jobs
+type QueueAggregate struct {
+	jobs   float64
+	cpus   float64
+	memory float64
+	gpus   float64
+}
+
+// jobNodes returns the number of nodes of the job taken from the TRES or
+// the node list, at least one
+func jobNodes(job *JobsMetrics) float64 {
+	if nodes := job.tres["node"]; nodes > 0 {
+		return nodes
+	}
+	if nodes := len(ExpandHostlist(job.nodes)); nodes > 0 {
+		return float64(nodes)
+	}
+	return 1
+}
+
+// jobMemory returns the memory of the job in bytes, preferring the
+// allocated TRES over the minimum memory, which is given per CPU ("c") or
+// per node
+func jobMemory(job *JobsMetrics) float64 {
+	if mem, ok := job.tres["mem"]; ok {
+		return mem
+	}
+	if strings.HasSuffix(strings.TrimSpace(job.min_mem), "c") {
+		return job.min_mem_bytes * job.num_cpus
+	}
+	return job.min_mem_bytes * jobNodes(job)
+}
+
+// jobGPUs returns the number of GPUs of the job taken from the allocated
+// TRES or, for jobs without allocation, from tres-per-node
+func jobGPUs(job *JobsMetrics) float64 {
+	if gpus := TRESGPUs(job.tres); gpus > 0 {
+		return gpus
+	}
+	return TRESGPUs(ParseTRES(job.tres_per_node)) * jobNodes(job)
+}
+
+// AggregateQueue groups queued jobs by the label values returned from key
+func AggregateQueue(jobs map[string]*JobsMetrics, key func(*JobsMetrics) []string) map[string]*QueueAggregate {
+	groups := make(map[string]*QueueAggregate)
+	for _, job := range jobs {
+		group := strings.Join(key(job), "|")
+		if _, exists := groups[group]; !exists {
+			groups[group] = &QueueAggregate{}
+		}
+		// a pending array range stands for all of its tasks
+		count := 1.0
+		if job.is_array_task {
+			count = ArrayTaskCount(job.array_task_id)
+		}
+		groups[group].jobs += count
+		groups[group].cpus += job.num_cpus * count
+		groups[group].memory += jobMemory(job) * count
+		groups[group].gpus += jobGPUs(job) * count
+	}
+	return groups
+}
+
+func JobGetMetrics() map[string]*JobsMetrics {
 	return ParseJobMetrics(ExecuteCommand(SQUEUE))
 }
 
 // ParseNodeMetrics takes the output of sinfo with node data
 // It returns a map of metrics per node
-func ParseJobMetrics(input []byte) (map[string]*JobsMetrics, map[string]*CompletedJobsMetrics) {
+func ParseJobMetrics(input []byte) map[string]*JobsMetrics {
 	jobs := make(map[string]*JobsMetrics, 15)
 	lines := strings.Split(string(input), "\n")
 
@@ -81,7 +137,16 @@ func ParseJobMetrics(input []byte) (map[string]*JobsMetrics, map[string]*Complet
 		if strings.Contains(line, "|") {
 			split := strings.Split(line, "|")
 			jobid := strings.Fields(split[0])[0]
+			array_job_id := strings.TrimSpace(split[21])
+			array_task_id := strings.TrimSpace(split[22])
+			// pending array tasks may be printed as a range, e.g. 1234_[5-100]
+			if array_task_id != "N/A" && array_task_id != "" {
+				jobid = array_job_id + "_" + array_task_id
+			}
 			jobs[jobid] = &JobsMetrics{}
+			jobs[jobid].array_job_id = array_job_id
+			jobs[jobid].array_task_id = array_task_id
+			jobs[jobid].is_array_task = array_task_id != "N/A" && array_task_id != ""
 			jobs[jobid].sub_time = split[1]
 			jobs[jobid].start_time = split[2]
 			jobs[jobid].end_time = split[3]
@@ -97,6 +162,7 @@ func ParseJobMetrics(input []byte) (map[string]*JobsMetrics, map[string]*Complet
 			jobs[jobid].min_mem = split[14]
 			jobs[jobid].account = split[15]
 			jobs[jobid].reason = split[16]
+			jobs[jobid].pending_reason = strings.TrimSpace(split[8])
 			if jobs[jobid].reason == jobs[jobid].nodes {
 				jobs[jobid].reason = ""
 			}
@@ -104,79 +170,173 @@ func ParseJobMetrics(input []byte) (map[string]*JobsMetrics, map[string]*Complet
 			jobs[jobid].tres_per_node = split[18]
 			jobs[jobid].qos = split[19]
 			jobs[jobid].tres_alloc = split[20]
-			jobs[jobid].partition = strings.Fields(split[21])[0]
+			jobs[jobid].tres = ParseTRES(split[20])
+			jobs[jobid].dependency = strings.TrimSpace(split[23])
+			jobs[jobid].dependencies = ParseDependency(split[23])
+			jobs[jobid].partition = strings.Fields(split[24])[0]
 
+			jobs[jobid].time_limit_sec, jobs[jobid].has_time_limit = ParseSlurmDuration(split[4])
+			jobs[jobid].time_left_sec, jobs[jobid].has_time_left = ParseSlurmDuration(split[5])
+			jobs[jobid].run_time_sec, _ = ParseSlurmDuration(split[6])
+			jobs[jobid].num_cpus, _ = strconv.ParseFloat(strings.TrimSpace(split[13]), 64)
+			jobs[jobid].min_mem_bytes, jobs[jobid].has_min_mem = ParseSlurmMemory(split[14])
+			jobs[jobid].priority_value, _ = strconv.ParseFloat(strings.TrimSpace(split[11]), 64)
+			jobs[jobid].submit_ts, jobs[jobid].has_submit = ParseSlurmTime(split[1])
+			jobs[jobid].start_ts, jobs[jobid].has_start = ParseSlurmTime(split[2])
+			jobs[jobid].end_ts, jobs[jobid].has_end = ParseSlurmTime(split[3])
 		}
 	}
 
-	completed_jobs := make(map[string]*CompletedJobsMetrics, 15)
-	lines = strings.Split(string(CompletedJobData()), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "|") {
-			split := strings.Split(line, "|")
-			for i, val := range split {
-				if val == "" {
-					split[i] = "None"
-				}
-			}
-			jobid := strings.Fields(split[0])[0]
-			completed_jobs[jobid] = &CompletedJobsMetrics{}
-
-			completed_jobs[jobid].user = split[1]
-			completed_jobs[jobid].account = split[2]
-			completed_jobs[jobid].partition = split[3]
-			completed_jobs[jobid].state = split[4]
-			completed_jobs[jobid].start = split[5]
-			completed_jobs[jobid].end = split[6]
-			completed_jobs[jobid].elapsed = split[7]
-			completed_jobs[jobid].nodes = split[8]
-			completed_jobs[jobid].priority = split[9]
-			completed_jobs[jobid].qos = split[10]
-			completed_jobs[jobid].alloc_tres = split[11]
-			if completed_jobs[jobid].start != "None" && completed_jobs[jobid].start != "Unknown" {
-				completed_jobs[jobid].new_start = ShiftTimeBack(completed_jobs[jobid].start)
-			}
-			if completed_jobs[jobid].end != "None" && completed_jobs[jobid].end != "Unknown" {
-				completed_jobs[jobid].new_end = ShiftTimeBack(completed_jobs[jobid].end)
-			}
+	return jobs
+}
 
-		}
+type queueDescs struct {
+	jobs   *prometheus.Desc
+	cpus   *prometheus.Desc
+	memory *prometheus.Desc
+	gpus   *prometheus.Desc
+}
+
+func newQueueDescs(prefix string, by string, labels []string) *queueDescs {
+	return &queueDescs{
+		jobs:   prometheus.NewDesc(prefix+"jobs", "Number of queued jobs by "+by, labels, nil),
+		cpus:   prometheus.NewDesc(prefix+"cpus", "CPUs requested by queued jobs by "+by, labels, nil),
+		memory: prometheus.NewDesc(prefix+"memory_bytes", "Memory in bytes requested by queued jobs by "+by, labels, nil),
+		gpus:   prometheus.NewDesc(prefix+"gpus", "GPUs requested by queued jobs by "+by, labels, nil),
 	}
+}
 
-	return jobs, completed_jobs
+func (qd *queueDescs) describe(ch chan<- *prometheus.Desc) {
+	ch <- qd.jobs
+	ch <- qd.cpus
+	ch <- qd.memory
+	ch <- qd.gpus
 }
 
-func CompletedJobData() []byte {
-	cmd := exec.Command("/bin/bash", "-c", "sacct -S now-30days -E now -o JobID,User,Account,Partition,State,Start,End,Elapsed,NodeList,Priority,QOS,AllocTRES --parsable2 --noheader | grep -v \".batch\"")
-	out, err := cmd.Output()
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if len(exitErr.Stderr) == 0 && exitErr.ExitCode() == 1 {
-				return []byte{}
-			} else {
-				log.Printf("Error executing sacct command: %v, stderr: %s", err, exitErr.Stderr)
-			}
-		} else {
-			log.Printf("Error executing sacct command: %v", err)
-		}
-		return []byte("")
+func (qd *queueDescs) collect(ch chan<- prometheus.Metric, groups map[string]*QueueAggregate) {
+	for group, agg := range groups {
+		labels := strings.Split(group, "|")
+		ch <- prometheus.MustNewConstMetric(qd.jobs, prometheus.GaugeValue, agg.jobs, labels...)
+		ch <- prometheus.MustNewConstMetric(qd.cpus, prometheus.GaugeValue, agg.cpus, labels...)
+		ch <- prometheus.MustNewConstMetric(qd.memory, prometheus.GaugeValue, agg.memory, labels...)
+		ch <- prometheus.MustNewConstMetric(qd.gpus, prometheus.GaugeValue, agg.gpus, labels...)
 	}
-	return out
 }
 
 type JobCollector struct {
-	queue     *prometheus.Desc
-	completed *prometheus.Desc
+	queue      *prometheus.Desc
+	completed  *prometheus.Desc
+	time_limit *prometheus.Desc
+	run_time   *prometheus.Desc
+	time_left  *prometheus.Desc
+	cpus       *prometheus.Desc
+	min_memory *prometheus.Desc
+	priority   *prometheus.Desc
+	submit     *prometheus.Desc
+	start      *prometheus.Desc
+	end        *prometheus.Desc
+
+	completed_start *prometheus.Desc
+	completed_end   *prometheus.Desc
+	array_tasks     *prometheus.Desc
+	alloc_tres      *prometheus.Desc
+	step_elapsed    *prometheus.Desc
+	step_exit_code  *prometheus.Desc
+	step_signal     *prometheus.Desc
+
+	queue_partition *queueDescs
+	queue_user      *queueDescs
+	queue_account   *queueDescs
+	queue_qos       *queueDescs
+	pending_jobs    *prometheus.Desc
+	pending_cpus    *prometheus.Desc
+	dependency_jobs *prometheus.Desc
+	never_satisfied *prometheus.Desc
+	chain_depth     *prometheus.Desc
+
+	// wait times are observed once per job, for jobs started after
+	// the collector was created
+	mutex        sync.Mutex
+	wait_seconds *prometheus.HistogramVec
+	started_ts   float64
+	started      map[string]float64
+
+	completed_jobs  *CompletedJobsCache
+	completed_total *prometheus.CounterVec
+	exit_code_total *prometheus.CounterVec
+	derived_total   *prometheus.CounterVec
+	efficiency      *EfficiencyMetrics
+	preemption      *PreemptionMetrics
+	time_limits     *TimeLimitMetrics
+	lifecycle       *JobLifecycle
+	chargeback      *Chargeback
 }
 
 // NewNodeCollector creates a Prometheus collector to keep all our stats in
 // It returns a set of collections for consumption
 func NewJobCollector() *JobCollector {
-	queue_labels := []string{"JOBID", "SUBMIT_TIME", "START_TIME", "END_TIME", "TIME_LIMIT", "STATUS", "USER", "GROUP", "PRIORITY", "RUN_TIME", "NODELIST", "CPUS", "MIN_MEM_REQUSTED", "ACCOUNT", "PARTITION", "REASON", "MIN_TMP_DISK", "TRES_PER_NODE", "QOS", "TRES_ALLOC"}
-	completed_labels := []string{"JOBID", "USER", "ACCOUNT", "PARTITION", "STATE", "START", "END", "ELAPSED", "NODES", "NEW_START", "NEW_END", "PRIORITY", "QOS", "ALLOC_TRES"}
+	queue_labels := []string{"JOBID", "SUBMIT_TIME", "START_TIME", "END_TIME", "TIME_LIMIT", "STATUS", "USER", "GROUP", "PRIORITY", "RUN_TIME", "NODELIST", "CPUS", "MIN_MEM_REQUSTED", "ACCOUNT", "PARTITION", "REASON", "MIN_TMP_DISK", "TRES_PER_NODE", "QOS", "TRES_ALLOC", "ARRAY_JOB_ID", "ARRAY_TASK_ID"}
+	completed_labels := []string{"JOBID", "USER", "ACCOUNT", "PARTITION", "STATE", "START", "END", "ELAPSED", "NODES", "PRIORITY", "QOS", "ALLOC_TRES"}
+	job_labels := []string{"JOBID", "USER", "ACCOUNT", "PARTITION"}
+	step_labels := []string{"JOBID", "COMPONENT", "STEP", "STATE"}
 	return &JobCollector{
-		queue:     prometheus.NewDesc("slurm_job_queue", "SLURM QUEUE INFO", queue_labels, nil),
-		completed: prometheus.NewDesc("slurm_job_completed", "SLURM COMPLETED JOBS FOR LAST 30 days", completed_labels, nil),
+		queue:      prometheus.NewDesc("slurm_job_queue", "SLURM QUEUE INFO", queue_labels, nil),
+		completed:  prometheus.NewDesc("slurm_job_completed", "SLURM COMPLETED JOBS FOR LAST 30 days", completed_labels, nil),
+		time_limit: prometheus.NewDesc("slurm_job_time_limit_seconds", "Job time limit in seconds, +Inf for UNLIMITED", job_labels, nil),
+		run_time:   prometheus.NewDesc("slurm_job_run_time_seconds", "Job run time in seconds", job_labels, nil),
+		time_left:  prometheus.NewDesc("slurm_job_time_left_seconds", "Job time left in seconds, +Inf for UNLIMITED", job_labels, nil),
+		cpus:       prometheus.NewDesc("slurm_job_cpus", "Number of CPUs requested or allocated by the job", job_labels, nil),
+		min_memory: prometheus.NewDesc("slurm_job_min_memory_bytes", "Minimum memory requested by the job in bytes", job_labels, nil),
+		priority:   prometheus.NewDesc("slurm_job_priority", "Job priority", job_labels, nil),
+		submit:     prometheus.NewDesc("slurm_job_submit_time_seconds", "Job submit time as Unix timestamp", job_labels, nil),
+		start:      prometheus.NewDesc("slurm_job_start_time_seconds", "Job actual or expected start time as Unix timestamp", job_labels, nil),
+		end:        prometheus.NewDesc("slurm_job_end_time_seconds", "Job actual or expected end time as Unix timestamp", job_labels, nil),
+
+		completed_start: prometheus.NewDesc("slurm_job_completed_start_time_seconds", "Start time of jobs reported by sacct as Unix timestamp", job_labels, nil),
+		completed_end:   prometheus.NewDesc("slurm_job_completed_end_time_seconds", "End time of jobs reported by sacct as Unix timestamp", job_labels, nil),
+
+		array_tasks: prometheus.NewDesc("slurm_job_array_tasks", "Number of tasks of a job array by state", []string{"array_job_id", "state"}, nil),
+		alloc_tres:  prometheus.NewDesc("slurm_job_alloc_tres", "TRES allocated to or requested by the job, memory and file system TRES in bytes", []string{"JOBID", "tres"}, nil),
+
+		step_elapsed:   prometheus.NewDesc("slurm_job_step_elapsed_seconds", "Elapsed time of job steps and heterogeneous job components", step_labels, nil),
+		step_exit_code: prometheus.NewDesc("slurm_job_step_exit_code", "Exit code of job steps and heterogeneous job components", step_labels, nil),
+		step_signal:    prometheus.NewDesc("slurm_job_step_exit_signal", "Signal that terminated job steps and heterogeneous job components", step_labels, nil),
+
+		queue_partition: newQueueDescs("slurm_queue_", "state and partition", []string{"state", "partition"}),
+		queue_user:      newQueueDescs("slurm_queue_user_", "user and state", []string{"user", "state"}),
+		queue_account:   newQueueDescs("slurm_queue_account_", "account and state", []string{"account", "state"}),
+		queue_qos:       newQueueDescs("slurm_queue_qos_", "QOS and state", []string{"qos", "state"}),
+		pending_jobs:    prometheus.NewDesc("slurm_queue_pending_jobs", "Number of pending jobs by partition and pending reason", []string{"partition", "reason"}, nil),
+		pending_cpus:    prometheus.NewDesc("slurm_queue_pending_cpus", "CPUs requested by pending jobs by partition and pending reason", []string{"partition", "reason"}, nil),
+		dependency_jobs: prometheus.NewDesc("slurm_queue_dependency_jobs", "Number of pending jobs by dependency type", []string{"type"}, nil),
+		never_satisfied: prometheus.NewDesc("slurm_queue_dependency_never_satisfied_jobs", "Number of pending jobs whose dependency can never be satisfied", []string{"partition", "user"}, nil),
+		chain_depth:     prometheus.NewDesc("slurm_user_dependency_chain_depth", "Longest chain of queued jobs a pending job of the user waits on", []string{"user"}, nil),
+		wait_seconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_job_wait_seconds",
+			Help:    "Time jobs waited before starting, since submit or since becoming eligible",
+			Buckets: []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 86400, 172800, 604800},
+		}, []string{"partition", "qos", "since"}),
+		started_ts: float64(time.Now().Unix()),
+		started:    make(map[string]float64),
+
+		completed_jobs: NewCompletedJobsCache(*sacctStateFile, *completedJobsRetention),
+		completed_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_completed_total",
+			Help: "Number of jobs that ended, by partition, state and account",
+		}, []string{"partition", "state", "account"}),
+		exit_code_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_exit_code_total",
+			Help: "Number of jobs that ended, by partition, account, state, exit code and signal",
+		}, []string{"partition", "account", "state", "exit_code", "signal"}),
+		derived_total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_derived_exit_code_total",
+			Help: "Number of jobs that ended, by partition, account, state and the highest exit code and signal of all job steps",
+		}, []string{"partition", "account", "state", "exit_code", "signal"}),
+		efficiency:  NewEfficiencyMetrics(),
+		preemption:  NewPreemptionMetrics(),
+		time_limits: NewTimeLimitMetrics(),
+		lifecycle:   NewJobLifecycle(),
+		chargeback:  NewChargeback(*chargebackStateFile),
 	}
 }
 
@@ -184,14 +344,223 @@ func NewJobCollector() *JobCollector {
 func (nc *JobCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.queue
 	ch <- nc.completed
+	ch <- nc.time_limit
+	ch <- nc.run_time
+	ch <- nc.time_left
+	ch <- nc.cpus
+	ch <- nc.min_memory
+	ch <- nc.priority
+	ch <- nc.submit
+	ch <- nc.start
+	ch <- nc.end
+	ch <- nc.completed_start
+	ch <- nc.completed_end
+	ch <- nc.array_tasks
+	ch <- nc.alloc_tres
+	ch <- nc.step_elapsed
+	ch <- nc.step_exit_code
+	ch <- nc.step_signal
+	nc.queue_partition.describe(ch)
+	nc.queue_user.describe(ch)
+	nc.queue_account.describe(ch)
+	nc.queue_qos.describe(ch)
+	ch <- nc.pending_jobs
+	ch <- nc.pending_cpus
+	ch <- nc.dependency_jobs
+	ch <- nc.never_satisfied
+	ch <- nc.chain_depth
+	nc.wait_seconds.Describe(ch)
+	nc.completed_total.Describe(ch)
+	nc.exit_code_total.Describe(ch)
+	nc.derived_total.Describe(ch)
+	nc.efficiency.Describe(ch)
+	nc.preemption.Describe(ch)
+	nc.time_limits.Describe(ch)
+	nc.lifecycle.Describe(ch)
+	nc.chargeback.Describe(ch)
+}
+
+// observeWaitTimes feeds the wait time histograms with jobs that started
+// since the previous collection. Job steps share the start of their job
+// and are skipped.
+func (nc *JobCollector) observeWaitTimes(completed map[string]*CompletedJobsMetrics) {
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	newest := nc.started_ts
+	for jobid, job := range completed {
+		if strings.Contains(jobid, ".") || !job.has_start || job.start_ts < nc.started_ts {
+			continue
+		}
+		if job.start_ts > newest {
+			newest = job.start_ts
+		}
+		if _, seen := nc.started[jobid]; seen {
+			continue
+		}
+		nc.started[jobid] = job.start_ts
+		if job.has_submit {
+			nc.wait_seconds.WithLabelValues(job.partition, job.qos, "submit").Observe(job.start_ts - job.submit_ts)
+		}
+		if job.has_eligible {
+			nc.wait_seconds.WithLabelValues(job.partition, job.qos, "eligible").Observe(job.start_ts - job.eligible_ts)
+		}
+	}
+
+	// jobs that started before the newest start are never seen again
+	for jobid, start := range nc.started {
+		if start < newest {
+			delete(nc.started, jobid)
+		}
+	}
+	nc.started_ts = newest
 }
 
 func (nc *JobCollector) Collect(ch chan<- prometheus.Metric) {
-	jobs, completed := JobGetMetrics()
+	jobs := JobGetMetrics()
+	completed, finished := nc.completed_jobs.Update()
 	for job := range jobs {
-		ch <- prometheus.MustNewConstMetric(nc.queue, prometheus.GaugeValue, float64(0), job, jobs[job].sub_time, jobs[job].start_time, jobs[job].end_time, jobs[job].time_limit, jobs[job].status, jobs[job].user, jobs[job].group, jobs[job].priority, jobs[job].run_time, jobs[job].nodes, jobs[job].cpus, jobs[job].min_mem, jobs[job].account, jobs[job].partition, jobs[job].reason, jobs[job].min_tmp_disk, jobs[job].tres_per_node, jobs[job].qos, jobs[job].tres_alloc)
+		// large arrays are covered by the per-array aggregates
+		if jobs[job].is_array_task && !*arrayTaskMetrics {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(nc.queue, prometheus.GaugeValue, float64(0), job, jobs[job].sub_time, jobs[job].start_time, jobs[job].end_time, jobs[job].time_limit, jobs[job].status, jobs[job].user, jobs[job].group, jobs[job].priority, jobs[job].run_time, jobs[job].nodes, jobs[job].cpus, jobs[job].min_mem, jobs[job].account, jobs[job].partition, jobs[job].reason, jobs[job].min_tmp_disk, jobs[job].tres_per_node, jobs[job].qos, jobs[job].tres_alloc, jobs[job].array_job_id, jobs[job].array_task_id)
+
+		labels := []string{job, jobs[job].user, jobs[job].account, jobs[job].partition}
+		ch <- prometheus.MustNewConstMetric(nc.run_time, prometheus.GaugeValue, jobs[job].run_time_sec, labels...)
+		ch <- prometheus.MustNewConstMetric(nc.cpus, prometheus.GaugeValue, jobs[job].num_cpus, labels...)
+		ch <- prometheus.MustNewConstMetric(nc.priority, prometheus.GaugeValue, jobs[job].priority_value, labels...)
+		if jobs[job].has_time_limit {
+			ch <- prometheus.MustNewConstMetric(nc.time_limit, prometheus.GaugeValue, jobs[job].time_limit_sec, labels...)
+		}
+		if jobs[job].has_time_left {
+			ch <- prometheus.MustNewConstMetric(nc.time_left, prometheus.GaugeValue, jobs[job].time_left_sec, labels...)
+		}
+		if jobs[job].has_min_mem {
+			ch <- prometheus.MustNewConstMetric(nc.min_memory, prometheus.GaugeValue, jobs[job].min_mem_bytes, labels...)
+		}
+		if jobs[job].has_submit {
+			ch <- prometheus.MustNewConstMetric(nc.submit, prometheus.GaugeValue, jobs[job].submit_ts, labels...)
+		}
+		if jobs[job].has_start {
+			ch <- prometheus.MustNewConstMetric(nc.start, prometheus.GaugeValue, jobs[job].start_ts, labels...)
+		}
+		if jobs[job].has_end {
+			ch <- prometheus.MustNewConstMetric(nc.end, prometheus.GaugeValue, jobs[job].end_ts, labels...)
+		}
+		for tres, value := range jobs[job].tres {
+			ch <- prometheus.MustNewConstMetric(nc.alloc_tres, prometheus.GaugeValue, value, job, tres)
+		}
+	}
+
+	nc.queue_partition.collect(ch, AggregateQueue(jobs, func(job *JobsMetrics) []string {
+		return []string{strings.TrimSpace(job.status), job.partition}
+	}))
+	if *queueUserMetrics {
+		nc.queue_user.collect(ch, AggregateQueue(jobs, func(job *JobsMetrics) []string {
+			return []string{strings.TrimSpace(job.user), strings.TrimSpace(job.status)}
+		}))
+	}
+	nc.queue_account.collect(ch, AggregateQueue(jobs, func(job *JobsMetrics) []string {
+		return []string{strings.TrimSpace(job.account), strings.TrimSpace(job.status)}
+	}))
+	nc.queue_qos.collect(ch, AggregateQueue(jobs, func(job *JobsMetrics) []string {
+		return []string{strings.TrimSpace(job.qos), strings.TrimSpace(job.status)}
+	}))
+
+	pending := make(map[string]*JobsMetrics)
+	for jobid, job := range jobs {
+		if strings.TrimSpace(job.status) == "PENDING" {
+			pending[jobid] = job
+		}
+	}
+	reasons := AggregateQueue(pending, func(job *JobsMetrics) []string {
+		return []string{job.partition, job.pending_reason}
+	})
+	for group, agg := range reasons {
+		labels := strings.Split(group, "|")
+		ch <- prometheus.MustNewConstMetric(nc.pending_jobs, prometheus.GaugeValue, agg.jobs, labels...)
+		ch <- prometheus.MustNewConstMetric(nc.pending_cpus, prometheus.GaugeValue, agg.cpus, labels...)
 	}
+
+	dependency_types := make(map[string]float64)
+	never_satisfied := make(map[string]float64)
+	for _, job := range pending {
+		types := make(map[string]bool)
+		for _, dependency := range job.dependencies {
+			types[dependency.kind] = true
+		}
+		for kind := range types {
+			dependency_types[kind]++
+		}
+		if NeverSatisfied(job) {
+			never_satisfied[job.partition+"|"+strings.TrimSpace(job.user)]++
+		}
+	}
+	for kind, count := range dependency_types {
+		ch <- prometheus.MustNewConstMetric(nc.dependency_jobs, prometheus.GaugeValue, count, kind)
+	}
+	for group, count := range never_satisfied {
+		ch <- prometheus.MustNewConstMetric(nc.never_satisfied, prometheus.GaugeValue, count, strings.Split(group, "|")...)
+	}
+	for user, depth := range UserChainDepths(jobs, pending) {
+		ch <- prometheus.MustNewConstMetric(nc.chain_depth, prometheus.GaugeValue, depth, user)
+	}
+
+	nc.observeWaitTimes(completed)
+	nc.wait_seconds.Collect(ch)
+
+	for jobid, job := range finished {
+		if strings.Contains(jobid, ".") {
+			continue
+		}
+		state := JobState(job.state)
+		nc.completed_total.WithLabelValues(job.partition, state, job.account).Inc()
+		exit_code, signal := ParseExitCode(job.exit_code)
+		nc.exit_code_total.WithLabelValues(job.partition, job.account, state, strconv.Itoa(int(exit_code)), strconv.Itoa(int(signal))).Inc()
+		exit_code, signal = ParseExitCode(job.derived_exit_code)
+		nc.derived_total.WithLabelValues(job.partition, job.account, state, strconv.Itoa(int(exit_code)), strconv.Itoa(int(signal))).Inc()
+	}
+	nc.completed_total.Collect(ch)
+	nc.exit_code_total.Collect(ch)
+	nc.derived_total.Collect(ch)
+
+	nc.lifecycle.Update(jobs, finished)
+	nc.lifecycle.Collect(ch)
+	nc.chargeback.Update(jobs, finished)
+	nc.chargeback.Collect(ch)
+
+	nc.efficiency.Observe(finished)
+	nc.efficiency.Collect(ch, completed, *efficiencyTopN)
+	nc.preemption.Observe(finished, float64(*requeueThreshold))
+	nc.preemption.Collect(ch, completed, float64(*requeueThreshold))
+	nc.time_limits.Observe(finished)
+	nc.time_limits.Collect(ch)
+
+	for array_job_id, states := range AggregateArrays(jobs, completed) {
+		for state, count := range states {
+			ch <- prometheus.MustNewConstMetric(nc.array_tasks, prometheus.GaugeValue, count, array_job_id, state)
+		}
+	}
+
 	for job := range completed {
-		ch <- prometheus.MustNewConstMetric(nc.completed, prometheus.GaugeValue, float64(0), job, completed[job].user, completed[job].account, completed[job].partition, completed[job].state, completed[job].start, completed[job].end, completed[job].elapsed, completed[job].nodes, completed[job].new_start, completed[job].new_end, completed[job].priority, completed[job].qos, completed[job].alloc_tres)
+		ch <- prometheus.MustNewConstMetric(nc.completed, prometheus.GaugeValue, float64(0), job, completed[job].user, completed[job].account, completed[job].partition, completed[job].state, completed[job].start, completed[job].end, completed[job].elapsed, completed[job].nodes, completed[job].priority, completed[job].qos, completed[job].alloc_tres)
+
+		labels := []string{job, completed[job].user, completed[job].account, completed[job].partition}
+		if completed[job].has_start {
+			ch <- prometheus.MustNewConstMetric(nc.completed_start, prometheus.GaugeValue, completed[job].start_ts, labels...)
+		}
+		if completed[job].has_end {
+			ch <- prometheus.MustNewConstMetric(nc.completed_end, prometheus.GaugeValue, completed[job].end_ts, labels...)
+		}
+		if !*jobStepMetrics {
+			continue
+		}
+		for _, step := range completed[job].steps {
+			step_labels := []string{job, step.component, step.step, step.state}
+			ch <- prometheus.MustNewConstMetric(nc.step_elapsed, prometheus.GaugeValue, step.elapsed_sec, step_labels...)
+			ch <- prometheus.MustNewConstMetric(nc.step_exit_code, prometheus.GaugeValue, step.exit_code, step_labels...)
+			ch <- prometheus.MustNewConstMetric(nc.step_signal, prometheus.GaugeValue, step.signal, step_labels...)
+		}
 	}
 }
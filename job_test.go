@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestJobMemoryAndGPUs(t *testing.T) {
+	const MiB = 1024 * 1024
+	tests := []struct {
+		name          string
+		min_mem       string
+		num_cpus      float64
+		nodes         string
+		tres_alloc    string
+		tres_per_node string
+		memory        float64
+		gpus          float64
+	}{
+		{"allocated", "4G", 8, "node[1-2]", "cpu=8,mem=16G,node=2,gres/gpu=4", "gres:gpu:2", 16 * 1024 * MiB, 4},
+		{"per CPU", "100Mc", 8, "", "", "", 800 * MiB, 0},
+		{"per node", "1G", 4, "node[1-3]", "", "", 3 * 1024 * MiB, 0},
+		{"per node from TRES", "1Gn", 4, "", "cpu=4,node=2", "", 2 * 1024 * MiB, 0},
+		{"pending", "1G", 4, "", "", "gres:gpu:2", 1024 * MiB, 2},
+		{"GPUs per node", "1G", 4, "node[1-2]", "", "gres/gpu:a100:2", 2 * 1024 * MiB, 4},
+	}
+	for _, test := range tests {
+		job := &JobsMetrics{
+			min_mem:       test.min_mem,
+			num_cpus:      test.num_cpus,
+			nodes:         test.nodes,
+			tres_per_node: test.tres_per_node,
+			tres:          ParseTRES(test.tres_alloc),
+		}
+		job.min_mem_bytes, _ = ParseSlurmMemory(test.min_mem)
+		if memory := jobMemory(job); memory != test.memory {
+			t.Errorf("%s: jobMemory = %v, want %v", test.name, memory, test.memory)
+		}
+		if gpus := jobGPUs(job); gpus != test.gpus {
+			t.Errorf("%s: jobGPUs = %v, want %v", test.name, gpus, test.gpus)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type lifecycleJob struct {
+	state        string
+	partition    string
+	account      string
+	array_job_id string
+	started      bool
+	// a pending array range such as "123_[1-100]" shrinks as its tasks
+	// start, the old key leaving the queue is not a departure
+	pending_range bool
+	// sacct reported the end while the job was still queued, e.g. as
+	// COMPLETING, and will not report it again
+	ended bool
+}
+
+// departedJob is a job that left the queue, it is remembered until sacct
+// reports that it ended
+type departedJob struct {
+	ts      time.Time
+	started bool
+}
+
+// sacct reports the end of a job shortly after it left the queue, a
+// departure without an end in this time is forgotten
+const departedRetention = time.Hour
+
+// JobLifecycle derives submit, start and finish counters from the
+// difference of two squeue snapshots. Jobs that start and end between two
+// collections are never seen in squeue and are taken from sacct instead.
+type JobLifecycle struct {
+	mutex    sync.Mutex
+	previous map[string]*lifecycleJob
+	departed map[string]*departedJob
+
+	submitted   *prometheus.CounterVec
+	started     *prometheus.CounterVec
+	finished    *prometheus.CounterVec
+	transitions *prometheus.CounterVec
+}
+
+func NewJobLifecycle() *JobLifecycle {
+	labels := []string{"partition", "account"}
+	return &JobLifecycle{
+		departed: make(map[string]*departedJob),
+		submitted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_submitted_total",
+			Help: "Number of jobs submitted, by partition and account",
+		}, labels),
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_started_total",
+			Help: "Number of jobs started, by partition and account",
+		}, labels),
+		finished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_finished_total",
+			Help: "Number of jobs finished, by partition and account",
+		}, labels),
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_job_state_transitions_total",
+			Help: "Number of job state changes seen between two collections",
+		}, []string{"from", "to"}),
+	}
+}
+
+func (jl *JobLifecycle) Describe(ch chan<- *prometheus.Desc) {
+	jl.submitted.Describe(ch)
+	jl.started.Describe(ch)
+	jl.finished.Describe(ch)
+	jl.transitions.Describe(ch)
+}
+
+func (jl *JobLifecycle) Collect(ch chan<- prometheus.Metric) {
+	jl.submitted.Collect(ch)
+	jl.started.Collect(ch)
+	jl.finished.Collect(ch)
+	jl.transitions.Collect(ch)
+}
+
+func isStarted(state string) bool {
+	return arrayTaskState(state) != "pending"
+}
+
+func isFinished(state string) bool {
+	category := arrayTaskState(state)
+	return category == "completed" || category == "failed"
+}
+
+// Update compares the queued jobs with the previous collection and the
+// jobs sacct reported as ended since then. The first collection only
+// records the queue.
+func (jl *JobLifecycle) Update(jobs map[string]*JobsMetrics, ended map[string]*CompletedJobsMetrics) {
+	jl.mutex.Lock()
+	defer jl.mutex.Unlock()
+
+	now := time.Now()
+	current := make(map[string]*lifecycleJob, len(jobs))
+	arrays := make(map[string]bool)
+	for _, job := range jl.previous {
+		if job.array_job_id != "" {
+			arrays[job.array_job_id] = true
+		}
+	}
+
+	for jobid, job := range jobs {
+		state := JobState(job.status)
+		current[jobid] = &lifecycleJob{
+			state:     state,
+			partition: job.partition,
+			account:   strings.TrimSpace(job.account),
+			started:   isStarted(state),
+		}
+		if job.is_array_task {
+			current[jobid].array_job_id = job.array_job_id
+			current[jobid].pending_range = strings.Contains(job.array_task_id, "[")
+		}
+		if jl.previous == nil {
+			continue
+		}
+
+		labels := []string{current[jobid].partition, current[jobid].account}
+		previous, seen := jl.previous[jobid]
+		if seen {
+			current[jobid].ended = previous.ended
+		}
+		if !seen {
+			// tasks leaving a pending array range were submitted with it
+			if !job.is_array_task || !arrays[job.array_job_id] {
+				count := 1.0
+				if job.is_array_task {
+					count = ArrayTaskCount(job.array_task_id)
+				}
+				jl.submitted.WithLabelValues(labels...).Add(count)
+			}
+			if current[jobid].started {
+				jl.started.WithLabelValues(labels...).Inc()
+			}
+			if isFinished(state) {
+				jl.finished.WithLabelValues(labels...).Inc()
+			}
+			continue
+		}
+
+		if previous.state != state {
+			jl.transitions.WithLabelValues(previous.state, state).Inc()
+		}
+		if !previous.started && current[jobid].started {
+			jl.started.WithLabelValues(labels...).Inc()
+		}
+		if !isFinished(previous.state) && isFinished(state) {
+			jl.finished.WithLabelValues(labels...).Inc()
+		}
+	}
+
+	if jl.previous != nil {
+		for jobid, previous := range jl.previous {
+			if _, queued := current[jobid]; queued || previous.pending_range {
+				continue
+			}
+			if !previous.ended {
+				jl.departed[jobid] = &departedJob{ts: now, started: previous.started}
+			}
+			if !isFinished(previous.state) {
+				jl.finished.WithLabelValues(previous.partition, previous.account).Inc()
+			}
+		}
+
+		// jobs sacct reports as ended, either departed or never seen queued
+		for jobid, job := range ended {
+			if strings.Contains(jobid, ".") {
+				continue
+			}
+			if queued, ok := current[jobid]; ok {
+				queued.ended = true
+				continue
+			}
+			labels := []string{job.partition, job.account}
+			// a pending job that left the queue may have run in between
+			if departed, ok := jl.departed[jobid]; ok {
+				if !departed.started && job.has_start {
+					jl.started.WithLabelValues(labels...).Inc()
+				}
+				delete(jl.departed, jobid)
+				continue
+			}
+			array_job_id := ""
+			if idx := strings.Index(jobid, "_"); idx >= 0 {
+				array_job_id = jobid[:idx]
+			}
+			if array_job_id == "" || !arrays[array_job_id] {
+				jl.submitted.WithLabelValues(labels...).Inc()
+			}
+			if job.has_start {
+				jl.started.WithLabelValues(labels...).Inc()
+			}
+			jl.finished.WithLabelValues(labels...).Inc()
+		}
+	}
+
+	for jobid, departed := range jl.departed {
+		if now.Sub(departed.ts) > departedRetention {
+			delete(jl.departed, jobid)
+		}
+	}
+	jl.previous = current
+}
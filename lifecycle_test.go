@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func queuedJob(status string) *JobsMetrics {
+	return &JobsMetrics{status: status, partition: "batch", account: "physics"}
+}
+
+func endedJob(has_start bool) *CompletedJobsMetrics {
+	return &CompletedJobsMetrics{partition: "batch", account: "physics", has_start: has_start, has_end: true}
+}
+
+func arrayRange(array_job_id string, array_task_id string) *JobsMetrics {
+	job := queuedJob("PENDING")
+	job.is_array_task = true
+	job.array_job_id = array_job_id
+	job.array_task_id = array_task_id
+	return job
+}
+
+func checkLifecycle(t *testing.T, jl *JobLifecycle, step string, submitted, started, finished float64) {
+	t.Helper()
+	counters := []struct {
+		name  string
+		got   float64
+		value float64
+	}{
+		{"submitted", testutil.ToFloat64(jl.submitted.WithLabelValues("batch", "physics")), submitted},
+		{"started", testutil.ToFloat64(jl.started.WithLabelValues("batch", "physics")), started},
+		{"finished", testutil.ToFloat64(jl.finished.WithLabelValues("batch", "physics")), finished},
+	}
+	for _, counter := range counters {
+		if counter.got != counter.value {
+			t.Errorf("%s: %s = %v, want %v", step, counter.name, counter.got, counter.value)
+		}
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	jl := NewJobLifecycle()
+	jl.Update(map[string]*JobsMetrics{"1": queuedJob("RUNNING")}, nil)
+	checkLifecycle(t, jl, "first collection", 0, 0, 0)
+
+	jl.Update(map[string]*JobsMetrics{"1": queuedJob("RUNNING"), "2": queuedJob("PENDING")}, nil)
+	checkLifecycle(t, jl, "submit", 1, 0, 0)
+
+	jl.Update(map[string]*JobsMetrics{"1": queuedJob("RUNNING"), "2": queuedJob("RUNNING")}, nil)
+	checkLifecycle(t, jl, "start", 1, 1, 0)
+	if got := testutil.ToFloat64(jl.transitions.WithLabelValues("PENDING", "RUNNING")); got != 1 {
+		t.Errorf("PENDING to RUNNING transitions = %v, want 1", got)
+	}
+
+	// job 1 leaves the queue before sacct reports its end
+	jl.Update(map[string]*JobsMetrics{"2": queuedJob("RUNNING")}, nil)
+	checkLifecycle(t, jl, "departure", 1, 1, 1)
+	if _, departed := jl.departed["1"]; !departed {
+		t.Error("job 1 is not remembered as departed")
+	}
+	jl.Update(map[string]*JobsMetrics{"2": queuedJob("RUNNING")}, map[string]*CompletedJobsMetrics{"1": endedJob(true)})
+	checkLifecycle(t, jl, "late sacct", 1, 1, 1)
+	if len(jl.departed) != 0 {
+		t.Errorf("departed jobs = %v, want none", jl.departed)
+	}
+
+	// job 3 starts and ends between two collections
+	jl.Update(map[string]*JobsMetrics{"2": queuedJob("RUNNING")}, map[string]*CompletedJobsMetrics{"3": endedJob(true)})
+	checkLifecycle(t, jl, "unseen job", 2, 2, 2)
+}
+
+// sacct reports the end of a completing job while squeue still lists it,
+// its departure afterwards is not waiting for sacct
+func TestJobLifecycleCompleting(t *testing.T) {
+	jl := NewJobLifecycle()
+	jl.Update(map[string]*JobsMetrics{"1": queuedJob("RUNNING")}, nil)
+	jl.Update(map[string]*JobsMetrics{"1": queuedJob("COMPLETING")}, map[string]*CompletedJobsMetrics{"1": endedJob(true)})
+	checkLifecycle(t, jl, "completing", 0, 0, 0)
+	jl.Update(map[string]*JobsMetrics{}, nil)
+	checkLifecycle(t, jl, "departure", 0, 0, 1)
+	if len(jl.departed) != 0 {
+		t.Errorf("departed jobs = %v, want none", jl.departed)
+	}
+}
+
+func TestJobLifecycleArrayRange(t *testing.T) {
+	jl := NewJobLifecycle()
+	jl.Update(map[string]*JobsMetrics{}, nil)
+	jl.Update(map[string]*JobsMetrics{"123_[1-100]": arrayRange("123", "[1-100]")}, nil)
+	checkLifecycle(t, jl, "array submit", 100, 0, 0)
+
+	// task 1 leaves the pending range and starts
+	task := arrayRange("123", "1")
+	task.status = "RUNNING"
+	jl.Update(map[string]*JobsMetrics{"123_[2-100]": arrayRange("123", "[2-100]"), "123_1": task}, nil)
+	checkLifecycle(t, jl, "range shrinks", 100, 1, 0)
+	jl.Update(map[string]*JobsMetrics{"123_[3-100]": arrayRange("123", "[3-100]"), "123_1": task}, nil)
+	checkLifecycle(t, jl, "range shrinks again", 100, 1, 0)
+	if len(jl.departed) != 0 {
+		t.Errorf("departed jobs = %v, want none", jl.departed)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"net/http"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -15,10 +16,15 @@ func init() {
 	prometheus.MustRegister(NewDiskCollector())
 	prometheus.MustRegister(NewAssocCollector())
 	prometheus.MustRegister(NewPrioCollector())
-	prometheus.MustRegister(NewJobCollector())
 	prometheus.MustRegister(NewNodeResCollector())
 	prometheus.MustRegister(NewCPUsCollector())       // from cpus.go
 	prometheus.MustRegister(NewPartitionsCollector()) // from partitions.go
+	prometheus.MustRegister(NewStartCollector())      // from start.go
+	prometheus.MustRegister(NewShareCollector())      // from sshare.go
+	prometheus.MustRegister(NewConfigCollector())     // from config.go
+	prometheus.MustRegister(NewRankCollector())       // from rank.go
+	prometheus.MustRegister(NewSdiagCollector())      // from sdiag.go
+	prometheus.MustRegister(NewControllerCollector()) // from controller.go
 }
 
 var listenAddress = flag.String(
@@ -31,17 +37,131 @@ var gpuAcct = flag.Bool(
 	false,
 	"Enable GPUs accounting")
 
+var queueUserMetrics = flag.Bool(
+	"queue-user-metrics",
+	true,
+	"Export queue aggregates per user")
+
+var sacctStateFile = flag.String(
+	"sacct-state-file",
+	"/var/lib/prometheus-slurm-exporter/sacct.state",
+	"File to persist the end time of the newest job seen by sacct and the jobs counted shortly before it, empty to disable")
+
+var completedJobsRetention = flag.Duration(
+	"completed-jobs-retention",
+	30*24*time.Hour,
+	"How long completed jobs are exported after they ended")
+
+var chargebackStateFile = flag.String(
+	"chargeback-state-file",
+	"/var/lib/prometheus-slurm-exporter/chargeback.json",
+	"File to persist the TRES-seconds and cost counters per account, empty to disable")
+
+var chargebackRatesFile = flag.String(
+	"chargeback-rates",
+	"",
+	"JSON file with the cost of a TRES per hour by partition, e.g. {\"*\": {\"cpu\": 0.01}}")
+
+var efficiencyTopN = flag.Int(
+	"efficiency-top-n",
+	10,
+	"Number of the least CPU and memory efficient completed jobs to export")
+
+var requeueThreshold = flag.Int(
+	"requeue-threshold",
+	3,
+	"Number of requeues from which a completed job is reported as repeatedly requeued")
+
+var arrayTaskMetrics = flag.Bool(
+	"array-task-metrics",
+	true,
+	"Export per-job series for every job array task, disable to keep only the per-array aggregates")
+
+var jobStepMetrics = flag.Bool(
+	"job-step-metrics",
+	false,
+	"Export elapsed time, state and exit code of the steps of completed jobs, one set of series per step")
+
+var sreportEnabled = flag.Bool(
+	"sreport",
+	false,
+	"Enable cluster utilization reports from sreport")
+
+var sreportInterval = flag.Duration(
+	"sreport-interval",
+	time.Hour,
+	"How often the sreport queries are run")
+
+var sreportPeriods = flag.String(
+	"sreport-periods",
+	"24h,168h,720h",
+	"Comma separated rolling periods reported by sreport")
+
+var sreportTopCount = flag.Int(
+	"sreport-top-count",
+	10,
+	"Number of top users reported by sreport user topusage")
+
+var apiEnabled = flag.Bool(
+	"api",
+	false,
+	"Serve the cluster state as JSON under /api/v1, without authentication")
+
+var pendingRankLimit = flag.Int(
+	"pending-rank-limit",
+	100,
+	"Number of pending jobs per partition exported with their rank in the scheduling order")
+
+var sprioNormalized = flag.Bool(
+	"sprio-normalized",
+	false,
+	"Also export the priority factors of pending jobs normalized to 0-1 by sprio -n")
+
+var timezone = flag.String(
+	"timezone",
+	"",
+	"Timezone of the timestamps printed by Slurm commands, e.g. Europe/Moscow (default: local timezone)")
+
 func main() {
 	flag.Parse()
 
+	if err := SetSlurmTimezone(*timezone); err != nil {
+		log.Fatalf("Invalid timezone %s: %v", *timezone, err)
+	}
+	if *efficiencyTopN < 0 {
+		log.Fatalf("Invalid efficiency-top-n %d: must not be negative", *efficiencyTopN)
+	}
+	if err := SetChargebackRates(*chargebackRatesFile); err != nil {
+		log.Fatalf("Invalid chargeback rates %s: %v", *chargebackRatesFile, err)
+	}
+
+	// The job collector depends on command line options
+	prometheus.MustRegister(NewJobCollector())
+
 	// Turn on GPUs accounting only if the corresponding command line option is set to true.
 	if *gpuAcct {
 		prometheus.MustRegister(NewGPUsCollector()) // from gpus.go
 	}
+	// sreport queries are expensive for slurmdbd and run in the background.
+	if *sreportEnabled {
+		periods, err := ParseSreportPeriods(*sreportPeriods)
+		if err != nil {
+			log.Fatalf("Invalid sreport periods %s: %v", *sreportPeriods, err)
+		}
+		if *sreportInterval < minSreportInterval {
+			log.Fatalf("Invalid sreport-interval %v: must be at least %v", *sreportInterval, minSreportInterval)
+		}
+		prometheus.MustRegister(NewSreportCollector(periods, *sreportInterval, *sreportTopCount)) // from sreport.go
+	}
 	// The Handler function provides a default handler to expose metrics
 	// via an HTTP server. "/metrics" is the usual endpoint for that.
 	log.Infof("Starting Server: %s", *listenAddress)
 	log.Infof("GPUs Accounting: %t", *gpuAcct)
+	log.Infof("sreport: %t", *sreportEnabled)
+	log.Infof("JSON API: %t", *apiEnabled)
 	http.Handle("/metrics", promhttp.Handler())
+	if *apiEnabled {
+		RegisterAPI(http.DefaultServeMux) // from api.go
+	}
 	log.Fatal(http.ListenAndServe(*listenAddress, nil))
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Registering checks the descriptions of every collector, a nil or
+// inconsistent description makes the exporter fail at startup
+func TestRegisterCollectors(t *testing.T) {
+	collectors := map[string]prometheus.Collector{
+		"network":    NewNetworkCollector(),
+		"disk":       NewDiskCollector(),
+		"assoc":      NewAssocCollector(),
+		"prio":       NewPrioCollector(),
+		"node_res":   NewNodeResCollector(),
+		"cpus":       NewCPUsCollector(),
+		"partitions": NewPartitionsCollector(),
+		"start":      NewStartCollector(),
+		"share":      NewShareCollector(),
+		"config":     NewConfigCollector(),
+		"rank":       NewRankCollector(),
+		"sdiag":      NewSdiagCollector(),
+		"controller": NewControllerCollector(),
+		"job":        NewJobCollector(),
+		"gpus":       NewGPUsCollector(),
+	}
+	registry := prometheus.NewRegistry()
+	for name, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			t.Errorf("registering the %s collector failed: %v", name, err)
+		}
+	}
+}
@@ -22,6 +22,13 @@ type NodeResMetrics struct {
 	boot_time         string
 	slurmd_start_time string
 	ip                string
+
+	last_busy_ts     float64
+	boot_ts          float64
+	slurmd_start_ts  float64
+	has_last_busy    bool
+	has_boot         bool
+	has_slurmd_start bool
 }
 
 func NodeResGetMetrics() map[string]*NodeResMetrics {
@@ -93,6 +100,9 @@ func ParseNodeResMetrics() map[string]*NodeResMetrics {
 				}
 			}
 		}
+		nodes[nodeid].last_busy_ts, nodes[nodeid].has_last_busy = ParseSlurmTime(nodes[nodeid].last_busy_time)
+		nodes[nodeid].boot_ts, nodes[nodeid].has_boot = ParseSlurmTime(nodes[nodeid].boot_time)
+		nodes[nodeid].slurmd_start_ts, nodes[nodeid].has_slurmd_start = ParseSlurmTime(nodes[nodeid].slurmd_start_time)
 		if nodes[nodeid].reason == "" {
 			nodes[nodeid].reason = "OK"
 		}
@@ -107,7 +117,10 @@ func ParseNodeResMetrics() map[string]*NodeResMetrics {
 }
 
 type NodeResCollector struct {
-	node_res *prometheus.Desc
+	node_res     *prometheus.Desc
+	last_busy    *prometheus.Desc
+	boot         *prometheus.Desc
+	slurmd_start *prometheus.Desc
 }
 
 // NewNodeCollector creates a Prometheus collector to keep all our stats in
@@ -115,19 +128,36 @@ type NodeResCollector struct {
 func NewNodeResCollector() *NodeResCollector {
 	node_res_labels := []string{"NODE_NAME", "CPUAlloc", "CPUTot", "CPULoad", "RealMemory", "AllocMem", "FreeMem", "STATE", "PARTITIONS", "LastBusyTime", "BootTime", "SlurmdStartTime", "Reason", "IP"}
 
+	node_labels := []string{"NODE_NAME"}
+
 	return &NodeResCollector{
-		node_res: prometheus.NewDesc("slurm_node_resources", "NODE RESOURCES", node_res_labels, nil),
+		node_res:     prometheus.NewDesc("slurm_node_resources", "NODE RESOURCES", node_res_labels, nil),
+		last_busy:    prometheus.NewDesc("slurm_node_last_busy_time_seconds", "Time the node was last busy as Unix timestamp", node_labels, nil),
+		boot:         prometheus.NewDesc("slurm_node_boot_time_seconds", "Boot time of the node as Unix timestamp", node_labels, nil),
+		slurmd_start: prometheus.NewDesc("slurm_node_slurmd_start_time_seconds", "Start time of slurmd on the node as Unix timestamp", node_labels, nil),
 	}
 }
 
 // Send all metric descriptions
 func (nc *NodeResCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.node_res
+	ch <- nc.last_busy
+	ch <- nc.boot
+	ch <- nc.slurmd_start
 }
 
 func (nc *NodeResCollector) Collect(ch chan<- prometheus.Metric) {
 	nodes := NodeResGetMetrics()
 	for node := range nodes {
 		ch <- prometheus.MustNewConstMetric(nc.node_res, prometheus.GaugeValue, float64(0), node, nodes[node].cpu_alloc, nodes[node].cpu_total, nodes[node].cpu_load, nodes[node].real_mem, nodes[node].alloc_mem, nodes[node].free_mem, nodes[node].state, nodes[node].partitions, nodes[node].last_busy_time, nodes[node].boot_time, nodes[node].slurmd_start_time, nodes[node].reason, nodes[node].ip)
+		if nodes[node].has_last_busy {
+			ch <- prometheus.MustNewConstMetric(nc.last_busy, prometheus.GaugeValue, nodes[node].last_busy_ts, node)
+		}
+		if nodes[node].has_boot {
+			ch <- prometheus.MustNewConstMetric(nc.boot, prometheus.GaugeValue, nodes[node].boot_ts, node)
+		}
+		if nodes[node].has_slurmd_start {
+			ch <- prometheus.MustNewConstMetric(nc.slurmd_start, prometheus.GaugeValue, nodes[node].slurmd_start_ts, node)
+		}
 	}
 }
@@ -17,6 +17,8 @@ type NewPartitionMetrics struct {
 	reason              string
 	priority_job_factor string
 	priority_tier       string
+	// all nodes of the partition, sinfo prints one node list per state
+	nodes string
 }
 
 func ParsePartitionsMetrics() map[string]*NewPartitionMetrics {
@@ -53,7 +55,9 @@ func ParsePartitionsMetrics() map[string]*NewPartitionMetrics {
 			}
 			if strings.HasPrefix(word, "PriorityTier") {
 				partitions_info[current_partition].priority_tier = strings.Split(word, "=")[1]
-				break
+			}
+			if strings.HasPrefix(word, "Nodes=") {
+				partitions_info[current_partition].nodes = strings.TrimPrefix(word, "Nodes=")
 			}
 		}
 	}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PreemptionMetrics counts finished jobs that were preempted or requeued.
+// Slurm does not record which job preempted another one, the preempting
+// QOS are the candidates whose Preempt list contains the QOS of the job.
+type PreemptionMetrics struct {
+	preempted         *prometheus.CounterVec
+	preempted_cpu     *prometheus.CounterVec
+	requeues          *prometheus.CounterVec
+	repeated_requeues *prometheus.CounterVec
+	restarts          *prometheus.Desc
+}
+
+func NewPreemptionMetrics() *PreemptionMetrics {
+	return &PreemptionMetrics{
+		preempted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_preempted_total",
+			Help: "Number of jobs that ended preempted, by partition, QOS, the QOS that may preempt it and its preempt mode",
+		}, []string{"partition", "qos", "preemptor_qos", "preempt_mode"}),
+		preempted_cpu: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_preempted_cpu_seconds_total",
+			Help: "CPU time allocated to jobs that ended preempted, elapsed time multiplied by allocated CPUs",
+		}, []string{"partition", "qos"}),
+		requeues: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_requeues_total",
+			Help: "Number of times finished jobs were requeued, by partition and QOS",
+		}, []string{"partition", "qos"}),
+		repeated_requeues: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_repeated_requeue_total",
+			Help: "Number of finished jobs requeued at least as often as the requeue threshold",
+		}, []string{"partition", "qos"}),
+		restarts: prometheus.NewDesc("slurm_job_restarts", "Number of requeues of completed jobs requeued at least as often as the requeue threshold", []string{"JOBID", "USER", "ACCOUNT", "PARTITION", "QOS"}, nil),
+	}
+}
+
+func (pm *PreemptionMetrics) Describe(ch chan<- *prometheus.Desc) {
+	pm.preempted.Describe(ch)
+	pm.preempted_cpu.Describe(ch)
+	pm.requeues.Describe(ch)
+	pm.repeated_requeues.Describe(ch)
+	ch <- pm.restarts
+}
+
+// PreemptorQOS returns the QOS whose Preempt list contains qos
+func PreemptorQOS(qoss map[string]*QOSMetrics, qos string) []string {
+	preemptors := []string{}
+	for name, metrics := range qoss {
+		for _, preempted := range strings.Split(metrics.preemt, ",") {
+			if preempted == qos {
+				preemptors = append(preemptors, name)
+				break
+			}
+		}
+	}
+	sort.Strings(preemptors)
+	return preemptors
+}
+
+// Observe counts the jobs that finished since the previous collection.
+// The QOS are only queried from sacctmgr when a job was preempted.
+func (pm *PreemptionMetrics) Observe(finished map[string]*CompletedJobsMetrics, threshold float64) {
+	var qoss map[string]*QOSMetrics
+	for jobid, job := range finished {
+		if strings.Contains(jobid, ".") {
+			continue
+		}
+		if job.restarts > 0 {
+			pm.requeues.WithLabelValues(job.partition, job.qos).Add(job.restarts)
+			if job.restarts >= threshold {
+				pm.repeated_requeues.WithLabelValues(job.partition, job.qos).Inc()
+			}
+		}
+		if JobState(job.state) != "PREEMPTED" {
+			continue
+		}
+		if qoss == nil {
+			qoss = ParseQOSMetrics()
+		}
+		preemptors := strings.Join(PreemptorQOS(qoss, job.qos), ",")
+		if preemptors == "" {
+			preemptors = "unknown"
+		}
+		mode := "cluster"
+		if metrics, ok := qoss[job.qos]; ok && metrics.preemtmode != "None" && metrics.preemtmode != "" {
+			mode = strings.ToLower(metrics.preemtmode)
+		}
+		pm.preempted.WithLabelValues(job.partition, job.qos, preemptors, mode).Inc()
+		pm.preempted_cpu.WithLabelValues(job.partition, job.qos).Add(job.cpu_time_sec)
+	}
+}
+
+func (pm *PreemptionMetrics) Collect(ch chan<- prometheus.Metric, completed map[string]*CompletedJobsMetrics, threshold float64) {
+	pm.preempted.Collect(ch)
+	pm.preempted_cpu.Collect(ch)
+	pm.requeues.Collect(ch)
+	pm.repeated_requeues.Collect(ch)
+	for jobid, job := range completed {
+		if strings.Contains(jobid, ".") || job.restarts < threshold || job.restarts == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(pm.restarts, prometheus.GaugeValue, job.restarts, jobid, job.user, job.account, job.partition, job.qos)
+	}
+}
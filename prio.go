@@ -22,6 +22,8 @@ type PrioMetrics struct {
 	partition        string
 	tres_factor      string
 	user             string
+	fairshare_factor string
+	site_factor      string
 }
 
 type JobPrioMetrics struct {
@@ -31,6 +33,9 @@ type JobPrioMetrics struct {
 	jobsize_factor   float64
 	nice_factor      float64
 	qos_factor       float64
+	fairshare_factor float64
+	site_factor      float64
+	tres_factors     map[string]float64
 }
 
 type PriorityConfigs struct {
@@ -57,9 +62,23 @@ func PrioGetMetrics() (map[string]*PrioMetrics, PriorityConfigs, map[string]*Job
 	return ParsePrioMetrics(ExecuteCommand(SPRIO))
 }
 
+// NormalizedPrioGetMetrics returns the factors of pending jobs normalized
+// to 0-1, as printed by sprio -n with the lowercase format letters
+func NormalizedPrioGetMetrics() map[string]*JobPrioMetrics {
+	_, job_priorities := ParseSprio(ExecuteCommand(SPRIO_NORMALIZED))
+	return job_priorities
+}
+
 // ParseNodeMetrics takes the output of sinfo with node data
 // It returns a map of metrics per node
 func ParsePrioMetrics(input []byte) (map[string]*PrioMetrics, PriorityConfigs, map[string]*JobPrioMetrics) {
+	priorities, job_priorities := ParseSprio(input)
+	return priorities, ParsePriorityConfigs(), job_priorities
+}
+
+// ParseSprio takes the output of sprio, weighted or normalized
+// It returns the printed and the parsed factors per job
+func ParseSprio(input []byte) (map[string]*PrioMetrics, map[string]*JobPrioMetrics) {
 	priorities := make(map[string]*PrioMetrics, 15)
 	job_priorities := make(map[string]*JobPrioMetrics, 15)
 	lines := strings.Split(string(input), "\n")
@@ -71,8 +90,7 @@ func ParsePrioMetrics(input []byte) (map[string]*PrioMetrics, PriorityConfigs, m
 	for _, line := range linesUniq {
 		if strings.Contains(line, "|") {
 			split := strings.Split(line, "|")
-			jobid := split[0]
-			jobid = jobid[2:]
+			jobid := strings.TrimSpace(split[0])
 			priorities[jobid] = &PrioMetrics{}
 			priorities[jobid].priority = split[1]
 			priorities[jobid].age_factor = split[2]
@@ -86,20 +104,29 @@ func ParsePrioMetrics(input []byte) (map[string]*PrioMetrics, PriorityConfigs, m
 			priorities[jobid].qos_factor = split[9]
 			priorities[jobid].partition = split[10]
 			priorities[jobid].tres_factor = split[11]
-			priorities[jobid].user = split[12][:len(split[12])-1]
+			priorities[jobid].user = strings.TrimSpace(split[12])
+			priorities[jobid].fairshare_factor = strings.TrimSpace(split[13])
+			priorities[jobid].site_factor = strings.TrimSpace(split[14])
 
 			job_priorities[jobid] = &JobPrioMetrics{}
-			job_priorities[jobid].age_factor, _ = strconv.ParseFloat(priorities[jobid].age_factor, 64)
-			job_priorities[jobid].assoc_factor, _ = strconv.ParseFloat(priorities[jobid].assoc_factor, 64)
-			job_priorities[jobid].partition_factor, _ = strconv.ParseFloat(priorities[jobid].partition_factor, 64)
-			job_priorities[jobid].jobsize_factor, _ = strconv.ParseFloat(priorities[jobid].jobsize_factor, 64)
-			job_priorities[jobid].nice_factor, _ = strconv.ParseFloat(priorities[jobid].nice_factor, 64)
-			job_priorities[jobid].qos_factor, _ = strconv.ParseFloat(priorities[jobid].qos_factor, 64)
-
+			job_priorities[jobid].age_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].age_factor), 64)
+			job_priorities[jobid].assoc_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].assoc_factor), 64)
+			job_priorities[jobid].partition_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].partition_factor), 64)
+			job_priorities[jobid].jobsize_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].jobsize_factor), 64)
+			job_priorities[jobid].nice_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].nice_factor), 64)
+			job_priorities[jobid].qos_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].qos_factor), 64)
+			job_priorities[jobid].fairshare_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].fairshare_factor), 64)
+			job_priorities[jobid].site_factor, _ = strconv.ParseFloat(strings.TrimSpace(priorities[jobid].site_factor), 64)
+			job_priorities[jobid].tres_factors = ParseTRESCounts(priorities[jobid].tres_factor)
 		}
 	}
+	return priorities, job_priorities
+}
+
+// ParsePriorityConfigs takes the priority settings of scontrol show config
+func ParsePriorityConfigs() PriorityConfigs {
 	config := PriorityConfigs{}
-	lines = strings.Split(string(ExecuteCommand(SCONTROL_SHOW_CONF)), "\n")
+	lines := strings.Split(string(ExecuteCachedCommand(SCONTROL_SHOW_CONF, configCacheTTL)), "\n")
 	for _, line := range lines {
 		if strings.HasPrefix(line, "PriorityWeightTRES") {
 			config.PriorityWeightTRES = strings.Fields(line)[2]
@@ -159,7 +186,7 @@ func ParsePrioMetrics(input []byte) (map[string]*PrioMetrics, PriorityConfigs, m
 
 	}
 
-	return priorities, config, job_priorities
+	return config
 }
 
 // NodeData executes the sinfo command to get data for each node
@@ -174,6 +201,13 @@ type PrioCollector struct {
 	job_nice_factor      *prometheus.Desc
 	job_partition_factor *prometheus.Desc
 	job_qos_factor       *prometheus.Desc
+	job_fairshare_factor *prometheus.Desc
+	job_site_factor      *prometheus.Desc
+	job_tres_factor      *prometheus.Desc
+
+	// factors normalized to 0-1, only collected with -sprio-normalized
+	normalized      map[string]*prometheus.Desc
+	normalized_tres *prometheus.Desc
 }
 
 // NewNodeCollector creates a Prometheus collector to keep all our stats in
@@ -194,6 +228,19 @@ func NewPrioCollector() *PrioCollector {
 		job_nice_factor:      prometheus.NewDesc("slurm_nice_factor", "Slurm nice factor", factor_labels, nil),
 		job_partition_factor: prometheus.NewDesc("slurm_partition_factor", "Slurm partition factor", factor_labels, nil),
 		job_qos_factor:       prometheus.NewDesc("slurm_qos_factor", "Slurm qos factor", factor_labels, nil),
+		job_fairshare_factor: prometheus.NewDesc("slurm_fairshare_factor", "Slurm fairshare factor", factor_labels, nil),
+		job_site_factor:      prometheus.NewDesc("slurm_site_factor", "Slurm site factor", factor_labels, nil),
+		job_tres_factor:      prometheus.NewDesc("slurm_tres_factor", "Slurm TRES factor by TRES", []string{"JOBID", "PARTITION", "TRES"}, nil),
+
+		normalized: map[string]*prometheus.Desc{
+			"age":       prometheus.NewDesc("slurm_age_factor_normalized", "Slurm age factor normalized to 0-1", factor_labels, nil),
+			"assoc":     prometheus.NewDesc("slurm_assoc_factor_normalized", "Slurm assoc factor normalized to 0-1", factor_labels, nil),
+			"jobsize":   prometheus.NewDesc("slurm_jobsize_factor_normalized", "Slurm jobsize factor normalized to 0-1", factor_labels, nil),
+			"partition": prometheus.NewDesc("slurm_partition_factor_normalized", "Slurm partition factor normalized to 0-1", factor_labels, nil),
+			"qos":       prometheus.NewDesc("slurm_qos_factor_normalized", "Slurm qos factor normalized to 0-1", factor_labels, nil),
+			"fairshare": prometheus.NewDesc("slurm_fairshare_factor_normalized", "Slurm fairshare factor normalized to 0-1", factor_labels, nil),
+		},
+		normalized_tres: prometheus.NewDesc("slurm_tres_factor_normalized", "Slurm TRES factor normalized to 0-1 by TRES", []string{"JOBID", "PARTITION", "TRES"}, nil),
 	}
 
 }
@@ -208,6 +255,13 @@ func (nc *PrioCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- nc.job_nice_factor
 	ch <- nc.job_partition_factor
 	ch <- nc.job_qos_factor
+	ch <- nc.job_fairshare_factor
+	ch <- nc.job_site_factor
+	ch <- nc.job_tres_factor
+	for _, desc := range nc.normalized {
+		ch <- desc
+	}
+	ch <- nc.normalized_tres
 }
 
 func (nc *PrioCollector) Collect(ch chan<- prometheus.Metric) {
@@ -220,6 +274,40 @@ func (nc *PrioCollector) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(nc.job_nice_factor, prometheus.GaugeValue, job_priorities[job].nice_factor, job, priorities[job].partition)
 		ch <- prometheus.MustNewConstMetric(nc.job_partition_factor, prometheus.GaugeValue, job_priorities[job].partition_factor, job, priorities[job].partition)
 		ch <- prometheus.MustNewConstMetric(nc.job_qos_factor, prometheus.GaugeValue, job_priorities[job].qos_factor, job, priorities[job].partition)
+		ch <- prometheus.MustNewConstMetric(nc.job_fairshare_factor, prometheus.GaugeValue, job_priorities[job].fairshare_factor, job, priorities[job].partition)
+		ch <- prometheus.MustNewConstMetric(nc.job_site_factor, prometheus.GaugeValue, job_priorities[job].site_factor, job, priorities[job].partition)
+		for tres, value := range job_priorities[job].tres_factors {
+			ch <- prometheus.MustNewConstMetric(nc.job_tres_factor, prometheus.GaugeValue, value, job, priorities[job].partition, tres)
+		}
+	}
+	if *sprioNormalized {
+		nc.collectNormalized(ch, priorities)
 	}
 	ch <- prometheus.MustNewConstMetric(nc.prioconf, prometheus.GaugeValue, float64(0), conf.PriorityParameters, conf.PrioritySiteFactorParameters, conf.PrioritySiteFactorPlugin, conf.PriorityDecayHalfLife, conf.PriorityCalcPeriod, conf.PriorityFavorSmall, conf.PriorityFlags, conf.PriorityMaxAge, conf.PriorityUsageResetPeriod, conf.PriorityType, conf.PriorityWeightAge, conf.PriorityWeightAssoc, conf.PriorityWeightFairShare, conf.PriorityWeightJobSize, conf.PriorityWeightPartition, conf.PriorityWeightQOS, conf.PriorityWeightTRES)
 }
+
+// collectNormalized runs sprio -n with the lowercase format letters of the
+// normalized factors. The nice factor is an offset and the site factor is
+// set by the site, neither is normalized.
+func (nc *PrioCollector) collectNormalized(ch chan<- prometheus.Metric, priorities map[string]*PrioMetrics) {
+	for job, factors := range NormalizedPrioGetMetrics() {
+		partition := ""
+		if prio, ok := priorities[job]; ok {
+			partition = prio.partition
+		}
+		values := map[string]float64{
+			"age":       factors.age_factor,
+			"assoc":     factors.assoc_factor,
+			"jobsize":   factors.jobsize_factor,
+			"partition": factors.partition_factor,
+			"qos":       factors.qos_factor,
+			"fairshare": factors.fairshare_factor,
+		}
+		for name, value := range values {
+			ch <- prometheus.MustNewConstMetric(nc.normalized[name], prometheus.GaugeValue, value, job, partition)
+		}
+		for tres, value := range factors.tres_factors {
+			ch <- prometheus.MustNewConstMetric(nc.normalized_tres, prometheus.GaugeValue, value, job, partition, tres)
+		}
+	}
+}
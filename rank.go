@@ -0,0 +1,196 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PendingRank stores the position of a pending job in the scheduling order
+// of one of its partitions
+type PendingRank struct {
+	jobid      string
+	user       string
+	account    string
+	partition  string
+	rank       float64
+	cpus_ahead float64
+	gpus_ahead float64
+}
+
+type rankedJob struct {
+	jobid string
+	job   *JobsMetrics
+	tier  int
+}
+
+// jobPartitions returns the partitions a pending job was submitted to
+func jobPartitions(job *JobsMetrics) []string {
+	return strings.Split(job.partition, ",")
+}
+
+// partitionTiers returns the PriorityTier and the set of nodes of every
+// partition
+func partitionTiers(partitions map[string]*NewPartitionMetrics) (map[string]int, map[string]map[string]bool) {
+	tiers := make(map[string]int)
+	nodes := make(map[string]map[string]bool)
+	for name, partition := range partitions {
+		tier, err := strconv.Atoi(strings.TrimSpace(partition.priority_tier))
+		if err != nil {
+			tier = 1
+		}
+		tiers[name] = tier
+		nodes[name] = make(map[string]bool)
+		for _, node := range ExpandHostlist(partition.nodes) {
+			nodes[name][node] = true
+		}
+	}
+	return tiers, nodes
+}
+
+func overlaps(a map[string]bool, b map[string]bool) bool {
+	for node := range a {
+		if b[node] {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingRanks orders the pending jobs of each partition the way the
+// scheduler considers them: jobs of overlapping partitions with a higher
+// PriorityTier first, then by priority and submit time. Jobs of
+// overlapping partitions with the same tier compete for the same nodes and
+// are ordered with the jobs of the partition.
+func PendingRanks(jobs map[string]*JobsMetrics, partitions map[string]*NewPartitionMetrics) []*PendingRank {
+	tiers, nodes := partitionTiers(partitions)
+	by_partition := make(map[string][]string)
+	for jobid, job := range jobs {
+		if JobState(job.status) != "PENDING" {
+			continue
+		}
+		for _, partition := range jobPartitions(job) {
+			by_partition[partition] = append(by_partition[partition], jobid)
+		}
+	}
+
+	ranks := []*PendingRank{}
+	for partition, members := range by_partition {
+		tier := tiers[partition]
+		candidates := make(map[string]*rankedJob)
+		for other, jobids := range by_partition {
+			if other != partition && (tiers[other] < tier || !overlaps(nodes[partition], nodes[other])) {
+				continue
+			}
+			for _, jobid := range jobids {
+				if ranked, ok := candidates[jobid]; !ok || tiers[other] > ranked.tier {
+					candidates[jobid] = &rankedJob{jobid, jobs[jobid], tiers[other]}
+				}
+			}
+		}
+		// a job of the partition is ordered by the tier of the partition
+		is_member := make(map[string]bool, len(members))
+		for _, jobid := range members {
+			candidates[jobid].tier = tier
+			is_member[jobid] = true
+		}
+
+		order := make([]*rankedJob, 0, len(candidates))
+		for _, ranked := range candidates {
+			order = append(order, ranked)
+		}
+		sort.Slice(order, func(i, j int) bool {
+			a, b := order[i], order[j]
+			if a.tier != b.tier {
+				return a.tier > b.tier
+			}
+			if a.job.priority_value != b.job.priority_value {
+				return a.job.priority_value > b.job.priority_value
+			}
+			if a.job.submit_ts != b.job.submit_ts {
+				return a.job.submit_ts < b.job.submit_ts
+			}
+			return a.jobid < b.jobid
+		})
+
+		jobs_ahead, cpus_ahead, gpus_ahead := 0.0, 0.0, 0.0
+		for _, ranked := range order {
+			count := 1.0
+			if ranked.job.is_array_task {
+				count = ArrayTaskCount(ranked.job.array_task_id)
+			}
+			if is_member[ranked.jobid] {
+				ranks = append(ranks, &PendingRank{
+					jobid:      ranked.jobid,
+					user:       strings.TrimSpace(ranked.job.user),
+					account:    strings.TrimSpace(ranked.job.account),
+					partition:  partition,
+					rank:       jobs_ahead + 1,
+					cpus_ahead: cpus_ahead,
+					gpus_ahead: gpus_ahead,
+				})
+			}
+			jobs_ahead += count
+			cpus_ahead += ranked.job.num_cpus * count
+			gpus_ahead += jobGPUs(ranked.job) * count
+		}
+	}
+	return ranks
+}
+
+type RankCollector struct {
+	rank            *prometheus.Desc
+	cpus_ahead      *prometheus.Desc
+	gpus_ahead      *prometheus.Desc
+	user_best_rank  *prometheus.Desc
+	user_cpus_ahead *prometheus.Desc
+	user_gpus_ahead *prometheus.Desc
+}
+
+func NewRankCollector() *RankCollector {
+	job_labels := []string{"JOBID", "USER", "ACCOUNT", "PARTITION"}
+	user_labels := []string{"user", "partition"}
+	return &RankCollector{
+		rank:            prometheus.NewDesc("slurm_job_pending_rank", "Position of the pending job in the scheduling order of the partition, 1 is scheduled first", job_labels, nil),
+		cpus_ahead:      prometheus.NewDesc("slurm_job_pending_cpus_ahead", "CPUs requested by the pending jobs ahead of the job", job_labels, nil),
+		gpus_ahead:      prometheus.NewDesc("slurm_job_pending_gpus_ahead", "GPUs requested by the pending jobs ahead of the job", job_labels, nil),
+		user_best_rank:  prometheus.NewDesc("slurm_user_pending_best_rank", "Best position of a pending job of the user in the scheduling order of the partition", user_labels, nil),
+		user_cpus_ahead: prometheus.NewDesc("slurm_user_pending_cpus_ahead", "CPUs requested by the pending jobs ahead of the best placed job of the user", user_labels, nil),
+		user_gpus_ahead: prometheus.NewDesc("slurm_user_pending_gpus_ahead", "GPUs requested by the pending jobs ahead of the best placed job of the user", user_labels, nil),
+	}
+}
+
+// Send all metric descriptions
+func (rc *RankCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rc.rank
+	ch <- rc.cpus_ahead
+	ch <- rc.gpus_ahead
+	ch <- rc.user_best_rank
+	ch <- rc.user_cpus_ahead
+	ch <- rc.user_gpus_ahead
+}
+
+// Collect exports the per-job series only for the first jobs of every
+// partition, up to -pending-rank-limit
+func (rc *RankCollector) Collect(ch chan<- prometheus.Metric) {
+	best := make(map[string]*PendingRank)
+	for _, rank := range PendingRanks(JobGetMetrics(), ParsePartitionsMetrics()) {
+		if rank.rank <= float64(*pendingRankLimit) {
+			labels := []string{rank.jobid, rank.user, rank.account, rank.partition}
+			ch <- prometheus.MustNewConstMetric(rc.rank, prometheus.GaugeValue, rank.rank, labels...)
+			ch <- prometheus.MustNewConstMetric(rc.cpus_ahead, prometheus.GaugeValue, rank.cpus_ahead, labels...)
+			ch <- prometheus.MustNewConstMetric(rc.gpus_ahead, prometheus.GaugeValue, rank.gpus_ahead, labels...)
+		}
+		key := rank.user + "|" + rank.partition
+		if current, ok := best[key]; !ok || rank.rank < current.rank {
+			best[key] = rank
+		}
+	}
+	for _, rank := range best {
+		ch <- prometheus.MustNewConstMetric(rc.user_best_rank, prometheus.GaugeValue, rank.rank, rank.user, rank.partition)
+		ch <- prometheus.MustNewConstMetric(rc.user_cpus_ahead, prometheus.GaugeValue, rank.cpus_ahead, rank.user, rank.partition)
+		ch <- prometheus.MustNewConstMetric(rc.user_gpus_ahead, prometheus.GaugeValue, rank.gpus_ahead, rank.user, rank.partition)
+	}
+}
@@ -162,8 +162,15 @@ func ParseAcctMetrics() (map[int]*AcctMetrics, map[string]*QOSMetrics) {
 		}
 		i = i + 1
 	}
+
+	return assocs, ParseQOSMetrics()
+}
+
+// ParseQOSMetrics runs sacctmgr show qos
+// It returns a map of metrics per QOS
+func ParseQOSMetrics() map[string]*QOSMetrics {
 	qoss := make(map[string]*QOSMetrics)
-	lines = strings.Split(string(ExecuteCommand(SACCT_SHOW_QOS)), "\n")
+	lines := strings.Split(string(ExecuteCommand(SACCT_SHOW_QOS)), "\n")
 	for _, line := range lines {
 		if strings.Contains(line, "|") {
 			split := strings.Split(line, "|")
@@ -298,34 +305,79 @@ func ParseAcctMetrics() (map[int]*AcctMetrics, map[string]*QOSMetrics) {
 		}
 	}
 
-	return assocs, qoss
+	return qoss
 }
 
 type AcctCollector struct {
 	assoc *prometheus.Desc
 	qos   *prometheus.Desc
+
+	assoc_grp_tres          *prometheus.Desc
+	assoc_grp_tres_mins     *prometheus.Desc
+	assoc_max_tres          *prometheus.Desc
+	assoc_max_tres_per_node *prometheus.Desc
+	qos_grp_tres            *prometheus.Desc
+	qos_max_tres            *prometheus.Desc
+	qos_max_tres_pu         *prometheus.Desc
+	qos_max_tres_pa         *prometheus.Desc
 }
 
 func NewAssocCollector() *AcctCollector {
 	acc_labels := []string{"Cluster", "Account", "User", "Partition", "Share", "Priority", "GrpJobs", "GrpTRES", "GrpSubmit", "GrpWall", "GrpTRESMins", "MaxJobs", "MaxTRES", "MaxTRESPerNode", "MaxSubmit", "MaxWall", "MaxTRESMins", "QOS", "Def_QOS", "GrpTRESRunMin"}
 	qos_labels := []string{"Name", "Priority", "GraceTime", "Preempt", "PreemptExemptTime", "PreemptMode", "Flags", "UsageThres", "UsageFactor", "GrpTRES", "GrpTRESMins", "GrpTRESRunMin", "GrpJobs", "GrpSubmit", "GrpWall", "MaxTRES", "MaxTRESPerNode", "MaxTRESMins", "MaxWall", "MaxTRESPU", "MaxJobsPU", "MaxSubmitPU", "MaxTRESPA", "MaxJobsPA", "MaxSubmitPA", "MinTRES"}
+	assoc_tres_labels := []string{"cluster", "account", "user", "partition", "tres"}
+	qos_tres_labels := []string{"qos", "tres"}
 	return &AcctCollector{
 		assoc: prometheus.NewDesc("slurm_sacct_assoc", "Info about slurm accounts", acc_labels, nil),
 		qos:   prometheus.NewDesc("slurm_sacct_qos", "Info about qos", qos_labels, nil),
+
+		assoc_grp_tres:          prometheus.NewDesc("slurm_assoc_grp_tres", "GrpTRES limit of the association, memory in bytes", assoc_tres_labels, nil),
+		assoc_grp_tres_mins:     prometheus.NewDesc("slurm_assoc_grp_tres_minutes", "GrpTRESMins limit of the association", assoc_tres_labels, nil),
+		assoc_max_tres:          prometheus.NewDesc("slurm_assoc_max_tres", "MaxTRES limit per job of the association, memory in bytes", assoc_tres_labels, nil),
+		assoc_max_tres_per_node: prometheus.NewDesc("slurm_assoc_max_tres_per_node", "MaxTRESPerNode limit of the association, memory in bytes", assoc_tres_labels, nil),
+		qos_grp_tres:            prometheus.NewDesc("slurm_qos_grp_tres", "GrpTRES limit of the QOS, memory in bytes", qos_tres_labels, nil),
+		qos_max_tres:            prometheus.NewDesc("slurm_qos_max_tres", "MaxTRES limit per job of the QOS, memory in bytes", qos_tres_labels, nil),
+		qos_max_tres_pu:         prometheus.NewDesc("slurm_qos_max_tres_per_user", "MaxTRESPU limit of the QOS, memory in bytes", qos_tres_labels, nil),
+		qos_max_tres_pa:         prometheus.NewDesc("slurm_qos_max_tres_per_account", "MaxTRESPA limit of the QOS, memory in bytes", qos_tres_labels, nil),
 	}
 }
 
 func (pc *AcctCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- pc.assoc
 	ch <- pc.qos
+	ch <- pc.assoc_grp_tres
+	ch <- pc.assoc_grp_tres_mins
+	ch <- pc.assoc_max_tres
+	ch <- pc.assoc_max_tres_per_node
+	ch <- pc.qos_grp_tres
+	ch <- pc.qos_max_tres
+	ch <- pc.qos_max_tres_pu
+	ch <- pc.qos_max_tres_pa
+}
+
+func collectTRES(ch chan<- prometheus.Metric, desc *prometheus.Desc, tres map[string]float64, labels ...string) {
+	for name, value := range tres {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, append(labels, name)...)
+	}
 }
 
 func (pc *AcctCollector) Collect(ch chan<- prometheus.Metric) {
 	assocs, qoss := ParseAcctMetrics()
 	for assoc := range assocs {
 		ch <- prometheus.MustNewConstMetric(pc.assoc, prometheus.GaugeValue, float64(0), assocs[assoc].cluster, assocs[assoc].account, assocs[assoc].user, assocs[assoc].partition, assocs[assoc].share, assocs[assoc].priority, assocs[assoc].grpjobs, assocs[assoc].grptres, assocs[assoc].grpsubmit, assocs[assoc].grpwall, assocs[assoc].grptresmins, assocs[assoc].maxjobs, assocs[assoc].maxtres, assocs[assoc].maxtrespernode, assocs[assoc].maxsubmit, assocs[assoc].maxwall, assocs[assoc].maxtresmins, assocs[assoc].qos, assocs[assoc].defqos, assocs[assoc].grptresrunmin)
+
+		a := assocs[assoc]
+		collectTRES(ch, pc.assoc_grp_tres, ParseTRES(a.grptres), a.cluster, a.account, a.user, a.partition)
+		collectTRES(ch, pc.assoc_grp_tres_mins, ParseTRESCounts(a.grptresmins), a.cluster, a.account, a.user, a.partition)
+		collectTRES(ch, pc.assoc_max_tres, ParseTRES(a.maxtres), a.cluster, a.account, a.user, a.partition)
+		collectTRES(ch, pc.assoc_max_tres_per_node, ParseTRES(a.maxtrespernode), a.cluster, a.account, a.user, a.partition)
 	}
 	for qos := range qoss {
 		ch <- prometheus.MustNewConstMetric(pc.qos, prometheus.GaugeValue, float64(0), qos, qoss[qos].priority, qoss[qos].gracetime, qoss[qos].preemt, qoss[qos].preemtexempttime, qoss[qos].preemtmode, qoss[qos].flags, qoss[qos].usagefactor, qoss[qos].grptres, qoss[qos].grptresmins, qoss[qos].grptresrunmin, qoss[qos].grpjobs, qoss[qos].grpsubmit, qoss[qos].priority, qoss[qos].grpwall, qoss[qos].maxtres, qoss[qos].maxtrespernode, qoss[qos].maxtresmins, qoss[qos].maxwall, qoss[qos].maxtrespu, qoss[qos].maxjobspu, qoss[qos].maxsubmitpu, qoss[qos].maxtrespa, qoss[qos].maxjobspa, qoss[qos].maxsubmitpa, qoss[qos].mintres)
+
+		collectTRES(ch, pc.qos_grp_tres, ParseTRES(qoss[qos].grptres), qos)
+		collectTRES(ch, pc.qos_max_tres, ParseTRES(qoss[qos].maxtres), qos)
+		collectTRES(ch, pc.qos_max_tres_pu, ParseTRES(qoss[qos].maxtrespu), qos)
+		collectTRES(ch, pc.qos_max_tres_pa, ParseTRES(qoss[qos].maxtrespa), qos)
 	}
 }
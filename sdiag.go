@@ -0,0 +1,215 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RPCStats stores the calls of one RPC message type or one user
+type RPCStats struct {
+	count      float64
+	total_time float64
+}
+
+// SdiagMetrics stores the values of sdiag, keyed by section and name,
+// e.g. "main/Last cycle" or "backfill/Depth Mean"
+type SdiagMetrics struct {
+	values    map[string]float64
+	rpc_types map[string]*RPCStats
+	rpc_users map[string]*RPCStats
+}
+
+func SdiagGetMetrics() *SdiagMetrics {
+	return ParseSdiagMetrics(ExecuteCommand(SDIAG))
+}
+
+// parseRPCStats parses an RPC statistics line such as
+// "REQUEST_PARTITION_INFO ( 2009) count:1000 ave_time:200 total_time:200000"
+func parseRPCStats(line string) (string, *RPCStats) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+	stats := &RPCStats{}
+	found := false
+	for _, field := range fields[1:] {
+		if strings.HasPrefix(field, "count:") {
+			stats.count, _ = strconv.ParseFloat(strings.TrimPrefix(field, "count:"), 64)
+			found = true
+		}
+		if strings.HasPrefix(field, "total_time:") {
+			stats.total_time, _ = strconv.ParseFloat(strings.TrimPrefix(field, "total_time:"), 64)
+		}
+	}
+	if !found {
+		return "", nil
+	}
+	return fields[0], stats
+}
+
+// ParseSdiagMetrics takes the output of sdiag
+func ParseSdiagMetrics(input []byte) *SdiagMetrics {
+	sdiag := &SdiagMetrics{
+		values:    make(map[string]float64),
+		rpc_types: make(map[string]*RPCStats),
+		rpc_users: make(map[string]*RPCStats),
+	}
+	section := ""
+	for _, line := range strings.Split(string(input), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			continue
+		case strings.HasPrefix(trimmed, "Main schedule statistics"):
+			section = "main"
+			continue
+		case strings.HasPrefix(trimmed, "Backfilling stats"):
+			section = "backfill"
+			continue
+		case strings.HasPrefix(trimmed, "Remote Procedure Call statistics by message type"):
+			section = "rpc_type"
+			continue
+		case strings.HasPrefix(trimmed, "Remote Procedure Call statistics by user"):
+			section = "rpc_user"
+			continue
+		case strings.HasPrefix(trimmed, "Pending RPC statistics"):
+			section = "pending"
+			continue
+		}
+
+		switch section {
+		case "rpc_type", "rpc_user":
+			name, stats := parseRPCStats(trimmed)
+			if stats == nil {
+				continue
+			}
+			if section == "rpc_type" {
+				sdiag.rpc_types[name] = stats
+			} else {
+				sdiag.rpc_users[name] = stats
+			}
+		case "pending":
+			continue
+		default:
+			idx := strings.Index(trimmed, ":")
+			if idx < 0 {
+				continue
+			}
+			// sections are indented, a line at the top level ends them
+			if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+				section = ""
+			}
+			fields := strings.Fields(trimmed[idx+1:])
+			if len(fields) == 0 {
+				continue
+			}
+			value, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				continue
+			}
+			key := trimmed[:idx]
+			if section != "" {
+				key = section + "/" + key
+			}
+			sdiag.values[key] = value
+		}
+	}
+	return sdiag
+}
+
+// sdiagValue describes a value of sdiag, times are reported in
+// microseconds
+type sdiagValue struct {
+	key          string
+	name         string
+	help         string
+	microseconds bool
+	counter      bool
+}
+
+var sdiagValues = []sdiagValue{
+	{"Server thread count", "slurm_scheduler_threads", "Number of slurmctld server threads", false, false},
+	{"Agent queue size", "slurm_scheduler_agent_queue_size", "Number of enqueued outgoing RPC requests of slurmctld", false, false},
+	{"Agent count", "slurm_scheduler_agent_count", "Number of agent threads of slurmctld", false, false},
+	{"DBD Agent queue size", "slurm_scheduler_dbd_agent_queue_size", "Number of messages for slurmdbd queued by slurmctld", false, false},
+	{"main/Last cycle", "slurm_scheduler_main_cycle_last_seconds", "Time of the last main scheduling cycle", true, false},
+	{"main/Mean cycle", "slurm_scheduler_main_cycle_mean_seconds", "Mean time of the main scheduling cycles", true, false},
+	{"main/Max cycle", "slurm_scheduler_main_cycle_max_seconds", "Longest main scheduling cycle", true, false},
+	{"main/Total cycles", "slurm_scheduler_main_cycles", "Number of main scheduling cycles since the statistics were reset", false, false},
+	{"main/Mean depth cycle", "slurm_scheduler_main_depth_mean", "Mean number of jobs considered by a main scheduling cycle", false, false},
+	{"main/Last queue length", "slurm_scheduler_main_queue_length", "Length of the job queue of the last main scheduling cycle", false, false},
+	{"backfill/Total backfilled jobs (since last slurm start)", "slurm_scheduler_backfilled_jobs_total", "Number of jobs started by the backfill scheduler since slurmctld started", false, true},
+	{"backfill/Total backfilled jobs (since last stats cycle start)", "slurm_scheduler_backfilled_jobs_since_reset", "Number of jobs started by the backfill scheduler since the statistics were reset", false, false},
+	{"backfill/Total cycles", "slurm_scheduler_backfill_cycles", "Number of backfill scheduling cycles since the statistics were reset", false, false},
+	{"backfill/Last cycle", "slurm_scheduler_backfill_cycle_last_seconds", "Time of the last backfill scheduling cycle", true, false},
+	{"backfill/Mean cycle", "slurm_scheduler_backfill_cycle_mean_seconds", "Mean time of the backfill scheduling cycles", true, false},
+	{"backfill/Max cycle", "slurm_scheduler_backfill_cycle_max_seconds", "Longest backfill scheduling cycle", true, false},
+	{"backfill/Last depth cycle", "slurm_scheduler_backfill_depth_last", "Number of jobs considered by the last backfill scheduling cycle", false, false},
+	{"backfill/Last depth cycle (try sched)", "slurm_scheduler_backfill_depth_try_last", "Number of jobs the last backfill scheduling cycle tried to schedule", false, false},
+	{"backfill/Depth Mean", "slurm_scheduler_backfill_depth_mean", "Mean number of jobs considered by a backfill scheduling cycle", false, false},
+	{"backfill/Depth Mean (try depth)", "slurm_scheduler_backfill_depth_try_mean", "Mean number of jobs a backfill scheduling cycle tried to schedule", false, false},
+	{"backfill/Last queue length", "slurm_scheduler_backfill_queue_length", "Length of the job queue of the last backfill scheduling cycle", false, false},
+}
+
+type SdiagCollector struct {
+	values         map[string]*prometheus.Desc
+	rpc_type_count *prometheus.Desc
+	rpc_type_time  *prometheus.Desc
+	rpc_user_count *prometheus.Desc
+	rpc_user_time  *prometheus.Desc
+}
+
+func NewSdiagCollector() *SdiagCollector {
+	values := make(map[string]*prometheus.Desc, len(sdiagValues))
+	for _, value := range sdiagValues {
+		values[value.key] = prometheus.NewDesc(value.name, value.help, nil, nil)
+	}
+	return &SdiagCollector{
+		values:         values,
+		rpc_type_count: prometheus.NewDesc("slurm_rpc_messages_total", "Number of RPCs received by slurmctld by message type since the statistics were reset", []string{"type"}, nil),
+		rpc_type_time:  prometheus.NewDesc("slurm_rpc_message_time_seconds_total", "Time slurmctld spent on RPCs by message type since the statistics were reset", []string{"type"}, nil),
+		rpc_user_count: prometheus.NewDesc("slurm_rpc_user_messages_total", "Number of RPCs received by slurmctld by user since the statistics were reset", []string{"user"}, nil),
+		rpc_user_time:  prometheus.NewDesc("slurm_rpc_user_time_seconds_total", "Time slurmctld spent on RPCs by user since the statistics were reset", []string{"user"}, nil),
+	}
+}
+
+// Send all metric descriptions
+func (sc *SdiagCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range sc.values {
+		ch <- desc
+	}
+	ch <- sc.rpc_type_count
+	ch <- sc.rpc_type_time
+	ch <- sc.rpc_user_count
+	ch <- sc.rpc_user_time
+}
+
+// The RPC statistics are reset at midnight and by sdiag -r, Prometheus
+// treats the drop like a counter reset
+func (sc *SdiagCollector) Collect(ch chan<- prometheus.Metric) {
+	sdiag := SdiagGetMetrics()
+	for _, value := range sdiagValues {
+		number, ok := sdiag.values[value.key]
+		if !ok {
+			continue
+		}
+		if value.microseconds {
+			number /= 1e6
+		}
+		value_type := prometheus.GaugeValue
+		if value.counter {
+			value_type = prometheus.CounterValue
+		}
+		ch <- prometheus.MustNewConstMetric(sc.values[value.key], value_type, number)
+	}
+	for name, stats := range sdiag.rpc_types {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_type_count, prometheus.CounterValue, stats.count, name)
+		ch <- prometheus.MustNewConstMetric(sc.rpc_type_time, prometheus.CounterValue, stats.total_time/1e6, name)
+	}
+	for name, stats := range sdiag.rpc_users {
+		ch <- prometheus.MustNewConstMetric(sc.rpc_user_count, prometheus.CounterValue, stats.count, name)
+		ch <- prometheus.MustNewConstMetric(sc.rpc_user_time, prometheus.CounterValue, stats.total_time/1e6, name)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+const sdiagOutput = `*******************************************************
+sdiag output at Wed Jan 31 12:00:00 2024 (1706702400)
+Data since      Wed Jan 31 00:00:00 2024 (1706659200)
+*******************************************************
+Server thread count:  3
+Agent queue size:     0
+Agent count:          0
+DBD Agent queue size: 5
+
+Jobs submitted: 120
+
+Main schedule statistics (microseconds):
+	Last cycle:   1500
+	Max cycle:    90000
+	Total cycles: 700
+	Mean cycle:   2000
+	Mean depth cycle:  25
+	Last queue length: 40
+
+Backfilling stats
+	Total backfilled jobs (since last slurm start): 300
+	Total backfilled jobs (since last stats cycle start): 12
+	Total cycles: 60
+	Last cycle: 250000
+	Max cycle:  800000
+	Mean cycle: 300000
+	Last depth cycle: 40
+	Last depth cycle (try sched): 20
+	Depth Mean: 35
+	Depth Mean (try depth): 18
+	Last queue length: 40
+
+Remote Procedure Call statistics by message type
+	REQUEST_PARTITION_INFO                  ( 2009) count:1000   ave_time:200    total_time:200000
+	REQUEST_JOB_INFO                        ( 2003) count:500    ave_time:1000   total_time:500000
+
+Remote Procedure Call statistics by user
+	root            (       0) count:1200   ave_time:500    total_time:600000
+	alice           (    1000) count:300    ave_time:333    total_time:100000
+
+Pending RPC statistics
+	REQUEST_TERMINATE_JOB                   ( 6011) count:2
+`
+
+func TestParseSdiagMetrics(t *testing.T) {
+	sdiag := ParseSdiagMetrics([]byte(sdiagOutput))
+	values := map[string]float64{
+		"Server thread count":   3,
+		"DBD Agent queue size":  5,
+		"Jobs submitted":        120,
+		"main/Last cycle":       1500,
+		"main/Total cycles":     700,
+		"backfill/Total cycles": 60,
+		"backfill/Total backfilled jobs (since last slurm start)": 300,
+		"backfill/Last depth cycle (try sched)":                   20,
+		"backfill/Depth Mean":                                     35,
+	}
+	for key, value := range values {
+		if sdiag.values[key] != value {
+			t.Errorf("%s = %v, want %v", key, sdiag.values[key], value)
+		}
+	}
+	if len(sdiag.rpc_types) != 2 || sdiag.rpc_types["REQUEST_JOB_INFO"].count != 500 || sdiag.rpc_types["REQUEST_JOB_INFO"].total_time != 500000 {
+		t.Errorf("RPC statistics by message type = %v", sdiag.rpc_types)
+	}
+	if len(sdiag.rpc_users) != 2 || sdiag.rpc_users["alice"].count != 300 {
+		t.Errorf("RPC statistics by user = %v", sdiag.rpc_users)
+	}
+	if _, ok := sdiag.rpc_types["REQUEST_TERMINATE_JOB"]; ok {
+		t.Errorf("pending RPC counted as received RPC")
+	}
+}
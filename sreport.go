@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sreport queries slurmdbd over whole periods, running them more often
+// than this only loads the database
+const minSreportInterval = time.Minute
+
+// ParseSreport takes the parsable output of sreport
+// It returns one map of column name to value per row. The report title
+// lines above the header are skipped.
+func ParseSreport(input []byte) []map[string]string {
+	rows := []map[string]string{}
+	header := []string{}
+	for _, line := range strings.Split(string(input), "\n") {
+		if !strings.Contains(line, "|") {
+			continue
+		}
+		split := strings.Split(line, "|")
+		if len(header) == 0 {
+			if strings.TrimSpace(split[0]) == "Cluster" {
+				header = split
+			}
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(split) {
+				row[strings.TrimSpace(name)] = strings.TrimSpace(split[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// sreportKind turns a cluster utilization column such as "PLND Down"
+// into a label value such as "plnd_down"
+func sreportKind(column string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(column), " ", "_", -1))
+}
+
+func sreportTRES(row map[string]string) string {
+	if tres, ok := row["TRES Name"]; ok && tres != "" {
+		return tres
+	}
+	return "cpu"
+}
+
+// ParseSreportPeriods takes the comma separated rolling periods of
+// -sreport-periods, e.g. "24h,168h", and rejects durations that are
+// invalid or not positive
+func ParseSreportPeriods(value string) ([]string, error) {
+	periods := []string{}
+	for _, period := range strings.Split(value, ",") {
+		period = strings.TrimSpace(period)
+		duration, err := time.ParseDuration(period)
+		if err != nil {
+			return nil, err
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("period %q is not positive", period)
+		}
+		periods = append(periods, period)
+	}
+	return periods, nil
+}
+
+// SreportCollector runs the sreport queries on a slow interval in the
+// background, as they are expensive for slurmdbd, and exposes the last
+// results on every collection
+type SreportCollector struct {
+	cluster_hours *prometheus.Desc
+	account_hours *prometheus.Desc
+	user_hours    *prometheus.Desc
+
+	mutex     sync.Mutex
+	metrics   []prometheus.Metric
+	periods   []string
+	top_count int
+}
+
+func NewSreportCollector(periods []string, interval time.Duration, top_count int) *SreportCollector {
+	sc := &SreportCollector{
+		cluster_hours: prometheus.NewDesc("slurm_sreport_cluster_hours", "Cluster TRES hours over the period by kind (allocated, down, idle, reserved, planned, reported)", []string{"cluster", "period", "tres", "kind"}, nil),
+		account_hours: prometheus.NewDesc("slurm_sreport_account_tres_hours", "TRES hours used by the account over the period", []string{"cluster", "period", "account", "tres"}, nil),
+		user_hours:    prometheus.NewDesc("slurm_sreport_user_top_usage_hours", "TRES hours used by the top users over the period", []string{"cluster", "period", "user", "account", "tres"}, nil),
+		periods:       periods,
+		top_count:     top_count,
+	}
+	go func() {
+		for {
+			sc.refresh()
+			time.Sleep(interval)
+		}
+	}()
+	return sc
+}
+
+func (sc *SreportCollector) refresh() {
+	metrics := []prometheus.Metric{}
+	end := time.Now()
+	for _, period := range sc.periods {
+		// the periods are validated by ParseSreportPeriods
+		duration, _ := time.ParseDuration(period)
+		start := FormatSlurmTime(end.Add(-duration))
+		stop := FormatSlurmTime(end)
+
+		for _, row := range ParseSreport(ExecuteCommand(fmt.Sprintf(SREPORT_CLUSTER_UTILIZATION, start, stop))) {
+			for column, value := range row {
+				if column == "Cluster" || column == "TRES Name" {
+					continue
+				}
+				if hours, err := strconv.ParseFloat(value, 64); err == nil {
+					metrics = append(metrics, prometheus.MustNewConstMetric(sc.cluster_hours, prometheus.GaugeValue, hours, row["Cluster"], period, sreportTRES(row), sreportKind(column)))
+				}
+			}
+		}
+		for _, row := range ParseSreport(ExecuteCommand(fmt.Sprintf(SREPORT_ACCOUNT_UTILIZATION, start, stop))) {
+			// rows without a login are the totals of the account
+			if row["Login"] != "" {
+				continue
+			}
+			if hours, err := strconv.ParseFloat(row["Used"], 64); err == nil {
+				metrics = append(metrics, prometheus.MustNewConstMetric(sc.account_hours, prometheus.GaugeValue, hours, row["Cluster"], period, row["Account"], sreportTRES(row)))
+			}
+		}
+		seen := make(map[string]bool)
+		for _, row := range ParseSreport(ExecuteCommand(fmt.Sprintf(SREPORT_USER_TOPUSAGE, start, stop, sc.top_count))) {
+			key := strings.Join([]string{row["Cluster"], row["Login"], row["Account"], sreportTRES(row)}, "|")
+			if hours, err := strconv.ParseFloat(row["Used"], 64); err == nil && !seen[key] {
+				seen[key] = true
+				metrics = append(metrics, prometheus.MustNewConstMetric(sc.user_hours, prometheus.GaugeValue, hours, row["Cluster"], period, row["Login"], row["Account"], sreportTRES(row)))
+			}
+		}
+	}
+
+	sc.mutex.Lock()
+	sc.metrics = metrics
+	sc.mutex.Unlock()
+}
+
+func (sc *SreportCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.cluster_hours
+	ch <- sc.account_hours
+	ch <- sc.user_hours
+}
+
+func (sc *SreportCollector) Collect(ch chan<- prometheus.Metric) {
+	sc.mutex.Lock()
+	defer sc.mutex.Unlock()
+	for _, metric := range sc.metrics {
+		ch <- metric
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sreportOutput = `--------------------------------------------------------------------------------
+Cluster Utilization 2024-01-30T00:00:00 - 2024-01-30T23:59:59
+Usage reported in TRES Hours
+--------------------------------------------------------------------------------
+Cluster|TRES Name|Allocated|Down|PLND Down|Idle|Planned|Reported
+cluster1|cpu|1000|10|0|200|5|1215
+cluster1|gres/gpu|80|0|0|16|0|96
+`
+
+func TestParseSreport(t *testing.T) {
+	rows := ParseSreport([]byte(sreportOutput))
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want 2", len(rows))
+	}
+	want := map[string]string{"Cluster": "cluster1", "TRES Name": "gres/gpu", "Allocated": "80", "Down": "0", "PLND Down": "0", "Idle": "16", "Planned": "0", "Reported": "96"}
+	if !reflect.DeepEqual(rows[1], want) {
+		t.Errorf("row = %v, want %v", rows[1], want)
+	}
+	if kind := sreportKind("PLND Down"); kind != "plnd_down" {
+		t.Errorf("sreportKind(\"PLND Down\") = %q, want plnd_down", kind)
+	}
+	if rows := ParseSreport([]byte("")); len(rows) != 0 {
+		t.Errorf("got %d rows of empty output, want 0", len(rows))
+	}
+}
+
+func TestParseSreportPeriods(t *testing.T) {
+	periods, err := ParseSreportPeriods("24h, 168h")
+	if err != nil || !reflect.DeepEqual(periods, []string{"24h", "168h"}) {
+		t.Errorf("ParseSreportPeriods(\"24h, 168h\") = %v, %v", periods, err)
+	}
+	for _, input := range []string{"24h,foo", "0s", "-1h", ""} {
+		if _, err := ParseSreportPeriods(input); err == nil {
+			t.Errorf("ParseSreportPeriods(%q) accepted an invalid period", input)
+		}
+	}
+}
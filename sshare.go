@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ShareMetrics struct {
+	account      string
+	user         string
+	parent       string
+	values       map[string]float64
+	grp_tres_raw map[string]float64
+}
+
+// shareColumns are the sshare columns exported as gauges
+var shareColumns = []struct {
+	column string
+	name   string
+	help   string
+}{
+	{"RawShares", "slurm_share_raw_shares", "Shares assigned to the association"},
+	{"NormShares", "slurm_share_norm_shares", "Shares of the association normalized to the shares of its siblings"},
+	{"RawUsage", "slurm_share_raw_usage", "Decayed usage of the association in TRES-seconds"},
+	{"NormUsage", "slurm_share_norm_usage", "Usage of the association normalized to the total usage"},
+	{"EffectvUsage", "slurm_share_effective_usage", "Usage of the association including the usage of its parents"},
+	{"FairShare", "slurm_share_fairshare", "Fairshare factor of the association"},
+	{"LevelFS", "slurm_share_level_fs", "Fairshare of the association compared to its siblings"},
+}
+
+func ShareGetMetrics() []*ShareMetrics {
+	return ParseShareMetrics(ExecuteCommand(SSHARE))
+}
+
+// ParseShareMetrics takes the output of sshare -a -l -P
+// It returns the fairshare tree in the order of the sshare output. The
+// depth of an account in the tree is given by the leading spaces of its
+// name, users belong to the account of their row.
+func ParseShareMetrics(input []byte) []*ShareMetrics {
+	shares := []*ShareMetrics{}
+	columns := make(map[string]int)
+	// the account seen last on every depth of the tree
+	path := []string{}
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(string(input), "\n") {
+		if !strings.Contains(line, "|") {
+			continue
+		}
+		split := strings.Split(line, "|")
+		if strings.TrimSpace(split[0]) == "Account" {
+			for i, name := range split {
+				columns[strings.TrimSpace(name)] = i
+			}
+			continue
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		account := strings.TrimSpace(split[columns["Account"]])
+		user := ""
+		if idx, ok := columns["User"]; ok && idx < len(split) {
+			user = strings.TrimSpace(split[idx])
+		}
+		depth := len(split[columns["Account"]]) - len(strings.TrimLeft(split[columns["Account"]], " "))
+
+		share := &ShareMetrics{
+			account:      account,
+			user:         user,
+			values:       make(map[string]float64),
+			grp_tres_raw: make(map[string]float64),
+		}
+		if user == "" {
+			if depth > len(path) {
+				depth = len(path)
+			}
+			path = append(path[:depth], account)
+			if depth > 0 {
+				share.parent = path[depth-1]
+			}
+		} else {
+			share.parent = account
+		}
+
+		for _, share_column := range shareColumns {
+			idx, ok := columns[share_column.column]
+			if !ok || idx >= len(split) {
+				continue
+			}
+			// RawShares of users sharing with their account is "parent"
+			if value, err := strconv.ParseFloat(strings.TrimSpace(split[idx]), 64); err == nil {
+				share.values[share_column.column] = value
+			}
+		}
+		if idx, ok := columns["GrpTRESRaw"]; ok && idx < len(split) {
+			share.grp_tres_raw = ParseTRESCounts(split[idx])
+		}
+
+		// users with associations on several partitions are listed once
+		// per partition with the same usage
+		key := account + "|" + user
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		shares = append(shares, share)
+	}
+	return shares
+}
+
+type ShareCollector struct {
+	values       map[string]*prometheus.Desc
+	grp_tres_raw *prometheus.Desc
+}
+
+func NewShareCollector() *ShareCollector {
+	share_labels := []string{"account", "user", "parent"}
+	values := make(map[string]*prometheus.Desc)
+	for _, share_column := range shareColumns {
+		values[share_column.column] = prometheus.NewDesc(share_column.name, share_column.help, share_labels, nil)
+	}
+	return &ShareCollector{
+		values:       values,
+		grp_tres_raw: prometheus.NewDesc("slurm_share_grp_tres_raw", "Decayed TRES usage of the association in TRES-minutes", append(share_labels, "tres"), nil),
+	}
+}
+
+func (sc *ShareCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, share_column := range shareColumns {
+		ch <- sc.values[share_column.column]
+	}
+	ch <- sc.grp_tres_raw
+}
+
+func (sc *ShareCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, share := range ShareGetMetrics() {
+		for column, value := range share.values {
+			ch <- prometheus.MustNewConstMetric(sc.values[column], prometheus.GaugeValue, value, share.account, share.user, share.parent)
+		}
+		for tres, value := range share.grp_tres_raw {
+			ch <- prometheus.MustNewConstMetric(sc.grp_tres_raw, prometheus.GaugeValue, value, share.account, share.user, share.parent, tres)
+		}
+	}
+}
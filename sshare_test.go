@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+const sshareOutput = `Account|User|RawShares|NormShares|RawUsage|NormUsage|EffectvUsage|FairShare|LevelFS|GrpTRESRaw
+root|||1.000000|1000|1.000000|1.000000|||cpu=16,mem=0
+ root|root|1|0.500000|0|0.000000|0.000000|1.000000|inf|cpu=0
+ physics||1|0.500000|1000|1.000000|1.000000||0.500000|cpu=16,gres/gpu=2
+  physics|alice|parent|0.500000|600|0.600000|0.600000|0.250000|0.833333|cpu=10
+  physics|alice|parent|0.500000|600|0.600000|0.600000|0.250000|0.833333|cpu=10
+`
+
+func TestParseShareMetrics(t *testing.T) {
+	shares := ParseShareMetrics([]byte(sshareOutput))
+	if len(shares) != 4 {
+		t.Fatalf("got %d associations, want 4", len(shares))
+	}
+	tests := []struct {
+		account, user, parent string
+		raw_usage             float64
+	}{
+		{"root", "", "", 1000},
+		{"root", "root", "root", 0},
+		{"physics", "", "root", 1000},
+		{"physics", "alice", "physics", 600},
+	}
+	for i, test := range tests {
+		share := shares[i]
+		if share.account != test.account || share.user != test.user || share.parent != test.parent {
+			t.Errorf("association %d = %s/%s parent %s, want %s/%s parent %s", i, share.account, share.user, share.parent, test.account, test.user, test.parent)
+		}
+		if share.values["RawUsage"] != test.raw_usage {
+			t.Errorf("RawUsage of %s/%s = %v, want %v", test.account, test.user, share.values["RawUsage"], test.raw_usage)
+		}
+	}
+	// users sharing with their account have no RawShares
+	if _, ok := shares[3].values["RawShares"]; ok {
+		t.Errorf("RawShares of physics/alice is set, want unset")
+	}
+	if shares[2].grp_tres_raw["gres/gpu"] != 2 {
+		t.Errorf("GrpTRESRaw gres/gpu of physics = %v, want 2", shares[2].grp_tres_raw["gres/gpu"])
+	}
+	if shares[3].values["FairShare"] != 0.25 {
+		t.Errorf("FairShare of physics/alice = %v, want 0.25", shares[3].values["FairShare"])
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type StartMetrics struct {
+	partition string
+	user      string
+	account   string
+	reason    string
+	start_ts  float64
+	evaluated bool
+}
+
+func StartGetMetrics() map[string]*StartMetrics {
+	return ParseStartMetrics(ExecuteCommand(SQUEUE_START))
+}
+
+// ParseStartMetrics takes the output of squeue --start
+// It returns a map of the expected start of every pending job. Jobs the
+// scheduler has not evaluated yet have no expected start time (N/A).
+func ParseStartMetrics(input []byte) map[string]*StartMetrics {
+	starts := make(map[string]*StartMetrics)
+	for _, line := range strings.Split(string(input), "\n") {
+		if !strings.Contains(line, "|") {
+			continue
+		}
+		split := strings.Split(line, "|")
+		if len(split) < 6 {
+			continue
+		}
+		jobid := strings.TrimSpace(split[0])
+		starts[jobid] = &StartMetrics{
+			partition: strings.TrimSpace(split[1]),
+			user:      strings.TrimSpace(split[2]),
+			account:   strings.TrimSpace(split[3]),
+			reason:    strings.TrimSpace(split[5]),
+		}
+		starts[jobid].start_ts, starts[jobid].evaluated = ParseSlurmTime(split[4])
+	}
+	return starts
+}
+
+// median returns the median of unsorted values
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+type StartCollector struct {
+	expected_start *prometheus.Desc
+	expected_wait  *prometheus.Desc
+	evaluated      *prometheus.Desc
+	wait_median    *prometheus.Desc
+	wait_max       *prometheus.Desc
+	unevaluated    *prometheus.Desc
+}
+
+func NewStartCollector() *StartCollector {
+	job_labels := []string{"JOBID", "PARTITION", "USER", "ACCOUNT"}
+	partition_labels := []string{"partition"}
+	return &StartCollector{
+		expected_start: prometheus.NewDesc("slurm_job_expected_start_time_seconds", "Start time of the pending job expected by the scheduler as Unix timestamp", job_labels, nil),
+		expected_wait:  prometheus.NewDesc("slurm_job_expected_wait_seconds", "Time until the expected start of the pending job", job_labels, nil),
+		evaluated:      prometheus.NewDesc("slurm_job_expected_start_evaluated", "1 if the scheduler has computed an expected start time for the pending job, 0 if not yet evaluated", job_labels, nil),
+		wait_median:    prometheus.NewDesc("slurm_partition_expected_wait_median_seconds", "Median time until the expected start of evaluated pending jobs", partition_labels, nil),
+		wait_max:       prometheus.NewDesc("slurm_partition_expected_wait_max_seconds", "Longest time until the expected start of evaluated pending jobs", partition_labels, nil),
+		unevaluated:    prometheus.NewDesc("slurm_partition_pending_unevaluated_jobs", "Number of pending jobs without an expected start time", partition_labels, nil),
+	}
+}
+
+func (sc *StartCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sc.expected_start
+	ch <- sc.expected_wait
+	ch <- sc.evaluated
+	ch <- sc.wait_median
+	ch <- sc.wait_max
+	ch <- sc.unevaluated
+}
+
+func (sc *StartCollector) Collect(ch chan<- prometheus.Metric) {
+	starts := StartGetMetrics()
+	now := float64(time.Now().Unix())
+	waits := make(map[string][]float64)
+	unevaluated := make(map[string]float64)
+	for jobid, job := range starts {
+		labels := []string{jobid, job.partition, job.user, job.account}
+		if !job.evaluated {
+			unevaluated[job.partition]++
+			ch <- prometheus.MustNewConstMetric(sc.evaluated, prometheus.GaugeValue, 0, labels...)
+			continue
+		}
+		wait := job.start_ts - now
+		if wait < 0 {
+			wait = 0
+		}
+		waits[job.partition] = append(waits[job.partition], wait)
+		ch <- prometheus.MustNewConstMetric(sc.evaluated, prometheus.GaugeValue, 1, labels...)
+		ch <- prometheus.MustNewConstMetric(sc.expected_start, prometheus.GaugeValue, job.start_ts, labels...)
+		ch <- prometheus.MustNewConstMetric(sc.expected_wait, prometheus.GaugeValue, wait, labels...)
+	}
+	for partition, partition_waits := range waits {
+		longest := partition_waits[0]
+		for _, wait := range partition_waits {
+			if wait > longest {
+				longest = wait
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(sc.wait_median, prometheus.GaugeValue, median(partition_waits), partition)
+		ch <- prometheus.MustNewConstMetric(sc.wait_max, prometheus.GaugeValue, longest, partition)
+	}
+	for partition, count := range unevaluated {
+		ch <- prometheus.MustNewConstMetric(sc.unevaluated, prometheus.GaugeValue, count, partition)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Completed jobs using less than this share of their time limit are
+// counted as overestimating it
+const timeLimitUnderuse = 0.1
+
+// TimeLimitMetrics compares the elapsed time of finished jobs with their
+// time limit, to find users whose limits keep backfill from scheduling.
+type TimeLimitMetrics struct {
+	usage     *prometheus.HistogramVec
+	timeout   *prometheus.CounterVec
+	underused *prometheus.CounterVec
+}
+
+func NewTimeLimitMetrics() *TimeLimitMetrics {
+	labels := []string{"partition", "account"}
+	return &TimeLimitMetrics{
+		usage: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "slurm_job_time_limit_usage",
+			Help:    "Elapsed time of finished jobs divided by their time limit",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 1, 1.1},
+		}, labels),
+		timeout: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_timeout_total",
+			Help: "Number of jobs that ended because they reached their time limit",
+		}, labels),
+		underused: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "slurm_jobs_time_limit_underused_total",
+			Help: "Number of jobs that completed using less than 10% of their time limit",
+		}, labels),
+	}
+}
+
+func (tm *TimeLimitMetrics) Describe(ch chan<- *prometheus.Desc) {
+	tm.usage.Describe(ch)
+	tm.timeout.Describe(ch)
+	tm.underused.Describe(ch)
+}
+
+// Observe adds the jobs that finished since the previous collection. Jobs
+// that never started or have no finite time limit are left out.
+func (tm *TimeLimitMetrics) Observe(finished map[string]*CompletedJobsMetrics) {
+	for jobid, job := range finished {
+		if strings.Contains(jobid, ".") || !job.has_start {
+			continue
+		}
+		state := JobState(job.state)
+		if state == "TIMEOUT" {
+			tm.timeout.WithLabelValues(job.partition, job.account).Inc()
+		}
+		if !job.has_time_limit || job.time_limit_sec <= 0 || math.IsInf(job.time_limit_sec, 0) {
+			continue
+		}
+		usage := job.elapsed_sec / job.time_limit_sec
+		tm.usage.WithLabelValues(job.partition, job.account).Observe(usage)
+		if state == "COMPLETED" && usage < timeLimitUnderuse {
+			tm.underused.WithLabelValues(job.partition, job.account).Inc()
+		}
+	}
+}
+
+func (tm *TimeLimitMetrics) Collect(ch chan<- prometheus.Metric) {
+	tm.usage.Collect(ch)
+	tm.timeout.Collect(ch)
+	tm.underused.Collect(ch)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseTRES converts a TRES string such as
+// "cpu=64,mem=256G,node=1,billing=64,gres/gpu=4,gres/gpu:a100=4" into a
+// map of TRES name to value. Memory and file system TRES are returned in
+// bytes. Counts in the colon form of tres-per-node, "gres/gpu:a100:2" or
+// "gres:gpu:2", are accepted as well.
+func ParseTRES(tres string) map[string]float64 {
+	result := make(map[string]float64)
+	for _, item := range strings.Split(strings.TrimSpace(tres), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value := item, ""
+		if idx := strings.Index(item, "="); idx >= 0 {
+			name, value = item[:idx], item[idx+1:]
+		} else if idx := strings.LastIndex(item, ":"); idx >= 0 {
+			name, value = item[:idx], item[idx+1:]
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				// "gres/gpu:a100" requests one GPU of the type
+				name, value = item, "1"
+			}
+		} else if strings.HasPrefix(item, "gres") {
+			value = "1"
+		} else {
+			continue
+		}
+		name = normalizeTRESName(name)
+
+		var parsed float64
+		var ok bool
+		if isTRESSize(name) {
+			parsed, ok = ParseSlurmMemory(value)
+		} else {
+			parsed, ok = parseTRESCount(value)
+		}
+		if ok {
+			result[name] = parsed
+		}
+	}
+	return result
+}
+
+// ParseTRESCounts converts a TRES string into a map of TRES name to value
+// without unit conversion, for usage such as GrpTRESRaw or TRES minutes
+func ParseTRESCounts(tres string) map[string]float64 {
+	result := make(map[string]float64)
+	for _, item := range strings.Split(strings.TrimSpace(tres), ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if value, ok := parseTRESCount(kv[1]); ok {
+			result[normalizeTRESName(kv[0])] = value
+		}
+	}
+	return result
+}
+
+// TRESGPUs returns the number of GPUs in parsed TRES. The untyped
+// "gres/gpu" holds the total, otherwise the typed GPUs are summed.
+func TRESGPUs(tres map[string]float64) float64 {
+	if gpus, ok := tres["gres/gpu"]; ok {
+		return gpus
+	}
+	gpus := float64(0)
+	for name, value := range tres {
+		if strings.HasPrefix(name, "gres/gpu:") {
+			gpus += value
+		}
+	}
+	return gpus
+}
+
+// normalizeTRESName turns the "gres:gpu" form of tres-per-node into the
+// "gres/gpu" form used by all other TRES strings
+func normalizeTRESName(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "gres:") {
+		name = "gres/" + name[len("gres:"):]
+	}
+	return name
+}
+
+func isTRESSize(name string) bool {
+	return name == "mem" || strings.HasPrefix(name, "fs/") || strings.HasPrefix(name, "bb/")
+}
+
+// parseTRESCount parses a TRES count that Slurm may shorten with a unit,
+// e.g. "1.50K"
+func parseTRESCount(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	multiplier := 1.0
+	switch value[len(value)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	case 'T':
+		multiplier = 1024 * 1024 * 1024 * 1024
+	case 'P':
+		multiplier = 1024 * 1024 * 1024 * 1024 * 1024
+	}
+	if multiplier != 1 {
+		value = value[:len(value)-1]
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return parsed * multiplier, true
+}
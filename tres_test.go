@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTRES(t *testing.T) {
+	tests := []struct {
+		input string
+		tres  map[string]float64
+	}{
+		{
+			"cpu=64,mem=256G,node=1,billing=64,gres/gpu=4,gres/gpu:a100=4",
+			map[string]float64{"cpu": 64, "mem": 256 * 1024 * 1024 * 1024, "node": 1, "billing": 64, "gres/gpu": 4, "gres/gpu:a100": 4},
+		},
+		{"cpu=2,mem=500M", map[string]float64{"cpu": 2, "mem": 500 * 1024 * 1024}},
+		{"gres:gpu:2", map[string]float64{"gres/gpu": 2}},
+		{"gres/gpu:a100:2", map[string]float64{"gres/gpu:a100": 2}},
+		{"gres/gpu:a100", map[string]float64{"gres/gpu:a100": 1}},
+		{"gres/gpu", map[string]float64{"gres/gpu": 1}},
+		{"billing=1.50K", map[string]float64{"billing": 1536}},
+		{"", map[string]float64{}},
+		{"N/A", map[string]float64{}},
+	}
+	for _, test := range tests {
+		if tres := ParseTRES(test.input); !reflect.DeepEqual(tres, test.tres) {
+			t.Errorf("ParseTRES(%q) = %v, want %v", test.input, tres, test.tres)
+		}
+	}
+}
+
+func TestTRESGPUs(t *testing.T) {
+	tests := []struct {
+		input string
+		gpus  float64
+	}{
+		{"cpu=4,gres/gpu=4,gres/gpu:a100=4", 4},
+		{"gres/gpu:a100=2,gres/gpu:v100=1", 3},
+		{"cpu=4", 0},
+	}
+	for _, test := range tests {
+		if gpus := TRESGPUs(ParseTRES(test.input)); gpus != test.gpus {
+			t.Errorf("TRESGPUs(%q) = %v, want %v", test.input, gpus, test.gpus)
+		}
+	}
+}
@@ -2,30 +2,46 @@ package main
 
 import (
 	"log"
+	"math"
+	"os"
 	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
-	NVDIA_QUERY             string = "nvidia-smi --query-gpu=name,driver_version,vbios_version,pstate,memory.total,memory.used,utilization.gpu,utilization.memory,temperature.gpu,power.draw.instant,power.limit,uuid,index,mig.mode.current --format=csv"
-	NVIDIA_SMI_MIG_LGIP     string = "nvidia-smi mig -lgip"
-	NVIDIA_SMI_MIG_LGI      string = "nvidia-smi mig -lgi"
-	DCGMI_DISCOVERY         string = "dcgmi discovery -c"
-	NVIDIA_SMI              string = "nvidia-smi"
-	NVIDIA_SMI_PMON         string = "nvidia-smi pmon -c 1"
-	SACCT_SHOW_ASSOC        string = "sacctmgr -n -p show assoc"
-	SACCT_SHOW_QOS          string = "sacctmgr -n -p show qos"
-	HOSTNAME                string = "hostname -s"
-	SPRIO                   string = "sprio -h -o \"%i|%Y|%A|%B|%P|%J|%n|%N|%o|%Q|%r|%T|%u\""
-	SCONTROL_SHOW_CONF      string = "scontrol show conf"
-	SINFO_PARTITIONS        string = "sinfo -h -o \"%R|%a|%D|%g|%G|%I|%N|%T|%E\""
-	SCONTROL_SHOW_PARTITION string = "scontrol -o show partition"
-	SCONTROL_SHOW_NODES     string = "scontrol show nodes -d -o"
-	SHOW_HOSTS              string = "cat /etc/hosts"
-	SHOW_LINKS              string = "ip -s link"
-	SQUEUE                  string = "squeue -a -r -h -O \"JOBID:|,SubmitTime:|,STARTTIME:|,ENDTIME:|,TIMELIMIT:|,TIMELEFT:|,TIMEUSED:|,STATE:|,REASON:|,USERNAME:|,GroupNAME:|,PRIORITYLONG:|,NODELIST:|,NumCPUs:|,MinMemory:|,ACCOUNT:|,ReasonList:|,MinTmpDisk:|,tres-per-node:|,QOS:|,tres-alloc:|,PARTITION\""
-	LSBLK                   string = "lsblk -Pb -o NAME,FSAVAIL,FSSIZE,SIZE,TYPE,PKNAME,MOUNTPOINTS"
-	CPU_INFO                string = "lscpu"
-	RAM_INFO                string = "free -b"
+	NVDIA_QUERY                 string = "nvidia-smi --query-gpu=name,driver_version,vbios_version,pstate,memory.total,memory.used,utilization.gpu,utilization.memory,temperature.gpu,power.draw.instant,power.limit,uuid,index,mig.mode.current --format=csv"
+	NVIDIA_SMI_MIG_LGIP         string = "nvidia-smi mig -lgip"
+	NVIDIA_SMI_MIG_LGI          string = "nvidia-smi mig -lgi"
+	DCGMI_DISCOVERY             string = "dcgmi discovery -c"
+	NVIDIA_SMI                  string = "nvidia-smi"
+	NVIDIA_SMI_PMON             string = "nvidia-smi pmon -c 1"
+	SACCT_SHOW_ASSOC            string = "sacctmgr -n -p show assoc"
+	SACCT_SHOW_QOS              string = "sacctmgr -n -p show qos"
+	HOSTNAME                    string = "hostname -s"
+	SPRIO                       string = "sprio -h -o \"%i|%Y|%A|%B|%P|%J|%n|%N|%o|%Q|%r|%T|%u|%F|%S\""
+	SPRIO_NORMALIZED            string = "sprio -n -h -o \"%i|%y|%a|%b|%p|%j|%n|%N|%o|%q|%r|%t|%u|%f|%S\""
+	SCONTROL_SHOW_CONF          string = "scontrol show conf"
+	SINFO_PARTITIONS            string = "sinfo -h -o \"%R|%a|%D|%g|%G|%I|%N|%T|%E\""
+	SCONTROL_SHOW_PARTITION     string = "scontrol -o show partition"
+	SCONTROL_SHOW_NODES         string = "scontrol show nodes -d -o"
+	SHOW_HOSTS                  string = "cat /etc/hosts"
+	SHOW_LINKS                  string = "ip -s link"
+	SQUEUE                      string = "squeue -a -r -h -O \"JOBID:|,SubmitTime:|,STARTTIME:|,ENDTIME:|,TIMELIMIT:|,TIMELEFT:|,TIMEUSED:|,STATE:|,REASON:|,USERNAME:|,GroupNAME:|,PRIORITYLONG:|,NODELIST:|,NumCPUs:|,MinMemory:|,ACCOUNT:|,ReasonList:|,MinTmpDisk:|,tres-per-node:|,QOS:|,tres-alloc:|,ArrayJobID:|,ArrayTaskID:|,Dependency:|,PARTITION\""
+	SACCT_JOBS                  string = "sacct -S %s -E now -o JobID,User,Account,Partition,State,Start,End,Elapsed,NodeList,Priority,QOS,AllocTRES,Submit,Eligible,TotalCPU,CPUTimeRAW,MaxRSS,ReqMem,ExitCode,DerivedExitCode,Restarts,Timelimit --parsable2 --noheader"
+	SQUEUE_START                string = "squeue --start -a -h -t PD -o \"%i|%P|%u|%a|%S|%r\""
+	SSHARE                      string = "sshare -a -l -P"
+	SDIAG                       string = "sdiag"
+	SCONTROL_PING               string = "scontrol ping"
+	SCONTROL_VERSION            string = "scontrol version"
+	SREPORT_CLUSTER_UTILIZATION string = "sreport -P -t Hours cluster utilization start=%s end=%s"
+	SREPORT_ACCOUNT_UTILIZATION string = "sreport -P -t Hours cluster AccountUtilizationByUser start=%s end=%s tres=ALL"
+	SREPORT_USER_TOPUSAGE       string = "sreport -P -t Hours user topusage start=%s end=%s TopCount=%d"
+	LSBLK                       string = "lsblk -Pb -o NAME,FSAVAIL,FSSIZE,SIZE,TYPE,PKNAME,MOUNTPOINTS"
+	CPU_INFO                    string = "lscpu"
+	RAM_INFO                    string = "free -b"
 )
 
 func ExecuteCommand(comm string) []byte {
@@ -42,6 +58,42 @@ func ExecuteCommand(comm string) []byte {
 	return out
 }
 
+// scontrol show config is read by several collectors during a scrape, its
+// output is shared for this long
+const configCacheTTL = 10 * time.Second
+
+type cachedOutput struct {
+	mutex sync.Mutex
+	ts    time.Time
+	out   []byte
+}
+
+var commandCache = struct {
+	sync.Mutex
+	outputs map[string]*cachedOutput
+}{outputs: make(map[string]*cachedOutput)}
+
+// ExecuteCachedCommand returns the output of comm, running it only when
+// the output of the previous run is older than ttl. Concurrent callers
+// wait for the same run.
+func ExecuteCachedCommand(comm string, ttl time.Duration) []byte {
+	commandCache.Lock()
+	cached, exists := commandCache.outputs[comm]
+	if !exists {
+		cached = &cachedOutput{}
+		commandCache.outputs[comm] = cached
+	}
+	commandCache.Unlock()
+
+	cached.mutex.Lock()
+	defer cached.mutex.Unlock()
+	if cached.out == nil || time.Since(cached.ts) > ttl {
+		cached.out = ExecuteCommand(comm)
+		cached.ts = time.Now()
+	}
+	return cached.out
+}
+
 func ShowPids() ([]byte, error) {
 	cmd := exec.Command("scontrol", "listpids")
 	out, err := cmd.Output()
@@ -61,3 +113,205 @@ func RemoveDuplicates(s []string) []string {
 
 	return t
 }
+
+// ParseSlurmDuration converts a Slurm duration such as "1-02:03:04",
+// "02:03:04", "03:04" or "UNLIMITED" into seconds. UNLIMITED is reported
+// as +Inf. The second return value is false for N/A, INVALID and other
+// values that carry no duration.
+func ParseSlurmDuration(input string) (float64, bool) {
+	input = strings.TrimSpace(input)
+	switch input {
+	case "UNLIMITED", "Partition_Limit", "INFINITE":
+		return math.Inf(1), true
+	case "", "N/A", "NOT_SET", "INVALID", "None", "Unknown":
+		return 0, false
+	}
+
+	// the layout depends on the presence of days, "0-05" carries hours
+	days, has_days := 0.0, false
+	if idx := strings.Index(input, "-"); idx >= 0 {
+		d, err := strconv.ParseFloat(input[:idx], 64)
+		if err != nil {
+			return 0, false
+		}
+		days, has_days = d, true
+		input = input[idx+1:]
+	}
+
+	parts := strings.Split(input, ":")
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, false
+		}
+		values[i] = v
+	}
+
+	var seconds float64
+	switch len(values) {
+	case 1:
+		// "D-HH" carries hours, a bare number carries minutes
+		if has_days {
+			seconds = values[0] * 3600
+		} else {
+			seconds = values[0] * 60
+		}
+	case 2:
+		if has_days {
+			seconds = values[0]*3600 + values[1]*60
+		} else {
+			seconds = values[0]*60 + values[1]
+		}
+	case 3:
+		seconds = values[0]*3600 + values[1]*60 + values[2]
+	default:
+		return 0, false
+	}
+
+	return days*86400 + seconds, true
+}
+
+// ParseSlurmMemory converts a Slurm memory size such as "4G", "500M" or
+// "4000Mn" into bytes. Values without a unit are in megabytes, the
+// default unit of Slurm memory options.
+func ParseSlurmMemory(input string) (float64, bool) {
+	input = strings.TrimSpace(input)
+	input = strings.TrimRight(input, "nc")
+	if input == "" || input == "N/A" {
+		return 0, false
+	}
+
+	multiplier := float64(1024 * 1024)
+	switch input[len(input)-1] {
+	case 'K', 'k':
+		multiplier = 1024
+	case 'M', 'm':
+		multiplier = 1024 * 1024
+	case 'G', 'g':
+		multiplier = 1024 * 1024 * 1024
+	case 'T', 't':
+		multiplier = 1024 * 1024 * 1024 * 1024
+	case 'P', 'p':
+		multiplier = 1024 * 1024 * 1024 * 1024 * 1024
+	}
+	if input[len(input)-1] < '0' || input[len(input)-1] > '9' {
+		input = input[:len(input)-1]
+	}
+
+	value, err := strconv.ParseFloat(input, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value * multiplier, true
+}
+
+// slurmLocation is the timezone the Slurm commands print timestamps in
+var slurmLocation = time.Local
+
+// SetSlurmTimezone sets the timezone used to parse Slurm timestamps. An
+// empty name keeps the local timezone of the exporter, taken from TZ or
+// /etc/localtime. Slurm commands print timestamps in the timezone of
+// their TZ, it is passed on to every command run afterwards.
+func SetSlurmTimezone(name string) error {
+	if name == "" {
+		slurmLocation = time.Local
+		return nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Setenv("TZ", name); err != nil {
+		return err
+	}
+	slurmLocation = location
+	return nil
+}
+
+// FormatSlurmTime formats t as a timestamp accepted by Slurm commands
+func FormatSlurmTime(t time.Time) string {
+	return t.In(slurmLocation).Format("2006-01-02T15:04:05")
+}
+
+// ParseSlurmTime converts a Slurm timestamp such as "2024-01-31T12:00:00"
+// into seconds since the Unix epoch. The second return value is false for
+// N/A, Unknown and None.
+func ParseSlurmTime(input string) (float64, bool) {
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", strings.TrimSpace(input), slurmLocation)
+	if err != nil {
+		return 0, false
+	}
+	return float64(t.Unix()), true
+}
+
+// ExpandHostlist expands a Slurm hostlist such as "node[01-03,05],gpu1"
+// into host names. Zero padding of the ranges is kept.
+func ExpandHostlist(hostlist string) []string {
+	hosts := []string{}
+	for _, item := range splitHostlist(strings.TrimSpace(hostlist)) {
+		hosts = append(hosts, expandHostlistItem(item)...)
+	}
+	return hosts
+}
+
+// splitHostlist splits a hostlist at the commas outside of brackets
+func splitHostlist(hostlist string) []string {
+	items := []string{}
+	depth, start := 0, 0
+	for i, c := range hostlist {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, hostlist[start:i])
+				start = i + 1
+			}
+		}
+	}
+	items = append(items, hostlist[start:])
+	result := items[:0]
+	for _, item := range items {
+		if item != "" && item != "(null)" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func expandHostlistItem(item string) []string {
+	left := strings.Index(item, "[")
+	right := strings.Index(item, "]")
+	if left < 0 || right < left {
+		return []string{item}
+	}
+	prefix, ranges, rest := item[:left], item[left+1:right], item[right+1:]
+	suffixes := expandHostlistItem(rest)
+	hosts := []string{}
+	for _, part := range strings.Split(ranges, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			continue
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				continue
+			}
+		}
+		for n := first; n <= last; n++ {
+			name := strconv.Itoa(n)
+			for len(name) < len(bounds[0]) {
+				name = "0" + name
+			}
+			for _, suffix := range suffixes {
+				hosts = append(hosts, prefix+name+suffix)
+			}
+		}
+	}
+	return hosts
+}
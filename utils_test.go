@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSlurmDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		seconds float64
+		ok      bool
+	}{
+		{"1-02:03:04", 93784, true},
+		{"02:03:04", 7384, true},
+		{"03:04", 184, true},
+		{"5", 300, true},
+		{"2-05", 190800, true},
+		{"2-05:30", 192600, true},
+		{"0-05", 18000, true},
+		{"0-01:30", 5400, true},
+		{"0-00:00:10", 10, true},
+		{" 10:00 ", 600, true},
+		{"UNLIMITED", math.Inf(1), true},
+		{"Partition_Limit", math.Inf(1), true},
+		{"N/A", 0, false},
+		{"INVALID", 0, false},
+		{"", 0, false},
+		{"1:2:3:4", 0, false},
+		{"x-01:00", 0, false},
+	}
+	for _, test := range tests {
+		seconds, ok := ParseSlurmDuration(test.input)
+		if seconds != test.seconds || ok != test.ok {
+			t.Errorf("ParseSlurmDuration(%q) = %v, %v, want %v, %v", test.input, seconds, ok, test.seconds, test.ok)
+		}
+	}
+}
+
+func TestParseSlurmMemory(t *testing.T) {
+	tests := []struct {
+		input string
+		bytes float64
+		ok    bool
+	}{
+		{"4G", 4 * 1024 * 1024 * 1024, true},
+		{"500M", 500 * 1024 * 1024, true},
+		{"4000Mn", 4000 * 1024 * 1024, true},
+		{"100Mc", 100 * 1024 * 1024, true},
+		{"1024K", 1024 * 1024, true},
+		{"2T", 2 * 1024 * 1024 * 1024 * 1024, true},
+		{"100", 100 * 1024 * 1024, true},
+		{"N/A", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		bytes, ok := ParseSlurmMemory(test.input)
+		if bytes != test.bytes || ok != test.ok {
+			t.Errorf("ParseSlurmMemory(%q) = %v, %v, want %v, %v", test.input, bytes, ok, test.bytes, test.ok)
+		}
+	}
+}
+
+func TestExpandHostlist(t *testing.T) {
+	tests := []struct {
+		input string
+		hosts []string
+	}{
+		{"node1", []string{"node1"}},
+		{"node[01-03,05],gpu1", []string{"node01", "node02", "node03", "node05", "gpu1"}},
+		{"rack[1-2]-node[1-2]", []string{"rack1-node1", "rack1-node2", "rack2-node1", "rack2-node2"}},
+		{"n[8-10]", []string{"n8", "n9", "n10"}},
+		{"a,b", []string{"a", "b"}},
+		{"(null)", []string{}},
+		{"", []string{}},
+	}
+	for _, test := range tests {
+		if hosts := ExpandHostlist(test.input); !reflect.DeepEqual(hosts, test.hosts) {
+			t.Errorf("ExpandHostlist(%q) = %v, want %v", test.input, hosts, test.hosts)
+		}
+	}
+}
+
+func TestSetSlurmTimezone(t *testing.T) {
+	tz, has_tz := os.LookupEnv("TZ")
+	defer func() {
+		if has_tz {
+			os.Setenv("TZ", tz)
+		} else {
+			os.Unsetenv("TZ")
+		}
+		SetSlurmTimezone("")
+	}()
+	if err := SetSlurmTimezone("Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	// the commands have to print their timestamps in the same timezone
+	if out := string(ExecuteCommand("echo -n $TZ")); out != "Asia/Tokyo" {
+		t.Errorf("TZ of commands = %q, want Asia/Tokyo", out)
+	}
+	ts, _ := ParseSlurmTime("2024-01-31T12:00:00")
+	if want := float64(time.Date(2024, 1, 31, 3, 0, 0, 0, time.UTC).Unix()); ts != want {
+		t.Errorf("ParseSlurmTime = %v, want %v", ts, want)
+	}
+	if err := SetSlurmTimezone("Nowhere/City"); err == nil {
+		t.Error("SetSlurmTimezone accepted an unknown timezone")
+	}
+}